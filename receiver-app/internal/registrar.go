@@ -0,0 +1,135 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	registerPath   = "/registerhost"
+	heartbeatPath  = "/heartbeat"
+	deregisterPath = "/deregisterhost"
+)
+
+var errHostNotRegistered = errors.New("host is not registered")
+
+func ConstructRegistrar(client *http.Client, routerUrl string, hostAddress string, weight int, leaseTtl time.Duration) *Registrar {
+	if leaseTtl < time.Second {
+		leaseTtl = time.Second
+	}
+
+	return &Registrar{
+		client:      client,
+		routerUrl:   strings.TrimSuffix(routerUrl, "/"),
+		hostAddress: hostAddress,
+		weight:      weight,
+		leaseTtl:    leaseTtl,
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+// Registrar keeps the application registered into the routing app. The host is registered with a lease
+// which is renewed by heartbeats sent every third of its ttl, and registered again whenever the routing
+// app no longer knows it, e.g. after its lease lapsed or the routing app restarted.
+type Registrar struct {
+	client      *http.Client
+	routerUrl   string
+	hostAddress string
+	weight      int
+	leaseTtl    time.Duration
+	stop        chan struct{}
+	done        chan struct{}
+}
+
+type registrationRequest struct {
+	HostAddress string `json:"hostAddress"`
+	Weight      int    `json:"weight,omitempty"`
+	TtlSeconds  int    `json:"ttlSeconds,omitempty"`
+}
+
+func (this *Registrar) Register() error {
+	return this.post(registerPath, registrationRequest{
+		HostAddress: this.hostAddress,
+		Weight:      this.weight,
+		TtlSeconds:  int(this.leaseTtl / time.Second),
+	})
+}
+
+// Heartbeat renews the lease, registering the host again when the routing app doesn't know it.
+func (this *Registrar) Heartbeat() error {
+	err := this.post(heartbeatPath, registrationRequest{HostAddress: this.hostAddress})
+	if errors.Is(err, errHostNotRegistered) {
+		fmt.Println("host no longer registered, registering again into", this.routerUrl)
+		return this.Register()
+	}
+	return err
+}
+
+// Start registers the host then sends heartbeats until Stop is called. Failures are logged and retried
+// on the next heartbeat.
+func (this *Registrar) Start() {
+	go func() {
+		defer close(this.done)
+
+		if err := this.Register(); err != nil {
+			fmt.Println("failed registering into routing app :", err)
+		}
+
+		ticker := time.NewTicker(this.leaseTtl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-this.stop:
+				return
+			case <-ticker.C:
+				if err := this.Heartbeat(); err != nil {
+					fmt.Println("failed sending heartbeat to routing app :", err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop ends the heartbeats and deregisters the host.
+func (this *Registrar) Stop() error {
+	close(this.stop)
+	<-this.done
+
+	return this.post(deregisterPath, registrationRequest{HostAddress: this.hostAddress})
+}
+
+// Private Functions
+
+func (this *Registrar) post(path string, body registrationRequest) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	response, err := this.client.Post(this.routerUrl+path, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotFound {
+		return errHostNotRegistered
+	}
+
+	if response.StatusCode != http.StatusOK {
+		var result struct {
+			Message string
+		}
+		raw, _ := io.ReadAll(response.Body)
+		json.Unmarshal(raw, &result)
+		return fmt.Errorf("%s returned status %d : %s", path, response.StatusCode, result.Message)
+	}
+	return nil
+}
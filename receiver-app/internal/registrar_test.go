@@ -0,0 +1,97 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// FakeRoutingApp records the registration calls it receives, answering heartbeats of unknown hosts
+// with 404.
+type FakeRoutingApp struct {
+	calls      []string
+	requests   []registrationRequest
+	registered bool
+	lock       sync.Mutex
+}
+
+func TestRegistrar_StartAndStop_RegisterThenDeregister(t *testing.T) {
+	routingApp, server := Helper_StartFakeRoutingApp(t)
+	registrar := ConstructRegistrar(server.Client(), server.URL+"/", "http://localhost:4001", 2, 3*time.Second)
+
+	registrar.Start()
+	assert.Eventually(t, func() bool { return len(routingApp.Calls()) >= 2 }, 3*time.Second, 10*time.Millisecond)
+	assert.NoError(t, registrar.Stop())
+
+	calls := routingApp.Calls()
+	assert.Equal(t, registerPath, calls[0])
+	assert.Equal(t, heartbeatPath, calls[1])
+	assert.Equal(t, deregisterPath, calls[len(calls)-1])
+
+	routingApp.lock.Lock()
+	defer routingApp.lock.Unlock()
+	assert.Equal(t, registrationRequest{HostAddress: "http://localhost:4001", Weight: 2, TtlSeconds: 3}, routingApp.requests[0])
+	assert.False(t, routingApp.registered)
+}
+
+func TestRegistrarHeartbeat_UnknownHost_RegisterAgain(t *testing.T) {
+	routingApp, server := Helper_StartFakeRoutingApp(t)
+	registrar := ConstructRegistrar(server.Client(), server.URL, "http://localhost:4001", 1, 30*time.Second)
+
+	err := registrar.Heartbeat()
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{heartbeatPath, registerPath}, routingApp.Calls())
+}
+
+func TestRegistrarRegister_Rejected_ReturnError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"message" : "Duplicate host address detected"}`))
+	}))
+	defer server.Close()
+	registrar := ConstructRegistrar(server.Client(), server.URL, "http://localhost:4001", 1, 30*time.Second)
+
+	err := registrar.Register()
+
+	assert.ErrorContains(t, err, "Duplicate host address detected")
+}
+
+func Helper_StartFakeRoutingApp(t *testing.T) (*FakeRoutingApp, *httptest.Server) {
+	routingApp := &FakeRoutingApp{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body registrationRequest
+		json.NewDecoder(r.Body).Decode(&body)
+
+		routingApp.lock.Lock()
+		defer routingApp.lock.Unlock()
+		routingApp.calls = append(routingApp.calls, r.URL.Path)
+		routingApp.requests = append(routingApp.requests, body)
+
+		switch r.URL.Path {
+		case registerPath:
+			routingApp.registered = true
+		case deregisterPath:
+			routingApp.registered = false
+		case heartbeatPath:
+			if !routingApp.registered {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+	return routingApp, server
+}
+
+func (this *FakeRoutingApp) Calls() []string {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return append([]string{}, this.calls...)
+}
@@ -2,21 +2,86 @@ package main
 
 import (
 	"andrewsaputra/receiver-app/internal"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-const defaultPort = "4000"
+const (
+	defaultPort                = "4000"
+	defaultLeaseTtlSeconds     = 30
+	registrationTimeoutSeconds = 5
+	shutdownTimeoutSeconds     = 10
+)
 
 var startTime time.Time = time.Now()
 
+// appOptions holds the command line arguments : an optional port followed or preceded by flags.
+type appOptions struct {
+	Port            string
+	RouterUrl       string
+	AdvertiseUrl    string
+	Weight          int
+	LeaseTtlSeconds int
+}
+
 func main() {
-	router := setupRouter()
-	router.Run(":" + getPort())
+	options, err := parseOptions(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		os.Exit(2)
+	}
+
+	server := &http.Server{
+		Addr:    ":" + options.Port,
+		Handler: setupRouter(),
+	}
+
+	go func() {
+		err := server.ListenAndServe()
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Println("failed starting server :", err)
+			os.Exit(1)
+		}
+	}()
+
+	var registrar *internal.Registrar
+	if options.RouterUrl != "" {
+		registrar = internal.ConstructRegistrar(
+			&http.Client{Timeout: registrationTimeoutSeconds * time.Second},
+			options.RouterUrl,
+			options.AdvertiseUrl,
+			options.Weight,
+			time.Duration(options.LeaseTtlSeconds)*time.Second,
+		)
+		registrar.Start()
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	<-signals
+
+	// deregister first, so the routing app stops sending requests before the server goes away
+	if registrar != nil {
+		if err := registrar.Stop(); err != nil {
+			fmt.Println("failed deregistering from routing app :", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeoutSeconds*time.Second)
+	defer cancel()
+	server.Shutdown(ctx)
 }
 
 func setupRouter() *gin.Engine {
@@ -29,14 +94,43 @@ func setupRouter() *gin.Engine {
 	return router
 }
 
-func getPort() string {
-	if len(os.Args) >= 2 {
-		if _, err := strconv.Atoi(os.Args[1]); err == nil {
-			return os.Args[1]
+func parseOptions(args []string) (appOptions, error) {
+	options := appOptions{}
+	flags := flag.NewFlagSet("receiver-app", flag.ContinueOnError)
+	flags.StringVar(&options.RouterUrl, "router", "", "url of the routing app to register into, e.g. http://localhost:3000")
+	flags.StringVar(&options.AdvertiseUrl, "advertise", "", "url registered into the routing app (default http://localhost:<port>)")
+	flags.IntVar(&options.Weight, "weight", 1, "weight registered into the routing app")
+	flags.IntVar(&options.LeaseTtlSeconds, "lease-ttl", defaultLeaseTtlSeconds, "seconds the registration lasts without heartbeats")
+
+	// flags may come before or after the port
+	positional := []string{}
+	for {
+		if err := flags.Parse(args); err != nil {
+			return options, err
 		}
+		if flags.NArg() == 0 {
+			break
+		}
+		positional = append(positional, flags.Arg(0))
+		args = flags.Args()[1:]
 	}
 
-	return defaultPort
+	options.Port = defaultPort
+	if len(positional) >= 1 {
+		port, err := strconv.Atoi(positional[0])
+		if err != nil || port < 1 || port > 65535 {
+			err = fmt.Errorf("invalid port %q", positional[0])
+			fmt.Fprintln(flags.Output(), err)
+			flags.Usage()
+			return options, err
+		}
+		options.Port = positional[0]
+	}
+
+	if options.AdvertiseUrl == "" {
+		options.AdvertiseUrl = "http://localhost:" + options.Port
+	}
+	return options, nil
 }
 
 func statusCheck(c *gin.Context) {
@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
-	"os"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -23,17 +22,43 @@ func TestStatusCheck_ReturnHealthy(t *testing.T) {
 	assert.Equal(t, "Healthy", responseJson["status"])
 }
 
-func TestGetPort_NoPortArgs_ReturnDefaultPort(t *testing.T) {
-	port := getPort()
-	assert.Equal(t, defaultPort, port)
+func TestParseOptions_NoPortArgs_ReturnDefaultPort(t *testing.T) {
+	options, err := parseOptions([]string{})
+	assert.NoError(t, err)
+	assert.Equal(t, defaultPort, options.Port)
 }
 
-func TestGetPort_HasPortArgs_ReturnSpecifiedPort(t *testing.T) {
-	oldArgs := os.Args
-	defer func() { os.Args = oldArgs }()
-
+func TestParseOptions_HasPortArgs_ReturnSpecifiedPort(t *testing.T) {
 	targetPort := "7777"
-	os.Args = []string{"cmd", targetPort}
-	port := getPort()
-	assert.Equal(t, targetPort, port)
+	options, err := parseOptions([]string{targetPort})
+	assert.NoError(t, err)
+	assert.Equal(t, targetPort, options.Port)
+}
+
+func TestParseOptions_NonNumericPort_ReturnError(t *testing.T) {
+	for _, port := range []string{"abc", "0", "70000"} {
+		_, err := parseOptions([]string{port})
+		assert.Error(t, err)
+	}
+}
+
+func TestParseOptions_FlagsAroundPort_ReturnOptions(t *testing.T) {
+	for _, args := range [][]string{
+		{"--router", "http://localhost:3000", "4001", "--weight", "3"},
+		{"4001", "--router=http://localhost:3000", "--weight=3"},
+	} {
+		options, err := parseOptions(args)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "4001", options.Port)
+		assert.Equal(t, "http://localhost:3000", options.RouterUrl)
+		assert.Equal(t, "http://localhost:4001", options.AdvertiseUrl)
+		assert.Equal(t, 3, options.Weight)
+		assert.Equal(t, defaultLeaseTtlSeconds, options.LeaseTtlSeconds)
+	}
+}
+
+func TestParseOptions_UnknownFlag_ReturnError(t *testing.T) {
+	_, err := parseOptions([]string{"--unknown"})
+	assert.Error(t, err)
 }
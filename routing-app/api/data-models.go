@@ -1,27 +1,169 @@
 package api
 
+import "time"
+
 type AppConfig struct {
 	RoutingAlgorithm string
 	RequestHandling  RequestHandlingConfig
 	HealthCheck      HealthCheckConfig
+	ConsistentHash   ConsistentHashConfig
+	LatencyAware     LatencyAwareConfig
+	HostStore        HostStoreConfig
+	Hosts            []HostSpec
+	HostsFile        HostsFileConfig
+	DnsDiscovery     DnsDiscoveryConfig
+	HostLease        HostLeaseConfig
+}
+
+type HostsFileConfig struct {
+	Path                string
+	PollIntervalSeconds int
+}
+
+type DnsDiscoveryConfig struct {
+	Name              string
+	RecordType        string
+	Scheme            string
+	Port              int
+	Server            string
+	TimeoutSeconds    int
+	MinRefreshSeconds int
+	MaxRefreshSeconds int
+}
+
+type HostLeaseConfig struct {
+	DefaultTtlSeconds    int
+	MaxTtlSeconds        int
+	SweepIntervalSeconds int
+}
+
+type HostStoreConfig struct {
+	Type string
+	Path string
 }
 
 type RequestHandlingConfig struct {
-	MaxRetries     int
-	TimeoutSeconds int
+	MaxRetries             int
+	TimeoutSeconds         int
+	TotalTimeoutSeconds    int
+	ClientTimeoutHeader    string
+	MaxClientTimeoutMillis int
+	RetryBufferBytes       int64
+	TrustedProxies         []string
+	RetryPolicy            RetryPolicyConfig
+	HedgedRoutes           []HedgedRouteConfig
+}
+
+type RetryPolicyConfig struct {
+	RetryableMethods     []string
+	RetryableStatusCodes []int
+	IdempotencyKeyHeader string
+	BackoffBaseMillis    int
+	BackoffMaxMillis     int
+	RetryBudget          RetryBudgetConfig
+}
+
+type RetryBudgetConfig struct {
+	Percent             int
+	MinRetriesPerSecond int
+	WindowSeconds       int
+}
+
+type HedgedRouteConfig struct {
+	PathPrefix      string
+	DelayPercentile int
+	MinDelayMillis  int
+	MaxDelayMillis  int
 }
 
 type HealthCheckConfig struct {
-	Path            string
-	NumRequired     int
-	IntervalSeconds int
-	TimeoutSeconds  int
+	Path                  string
+	NumRequired           int
+	IntervalSeconds       int
+	TimeoutSeconds        int
+	NoHealthyHostPolicy   string
+	PanicThresholdPercent int
+	OutlierDetection      OutlierDetectionConfig
+}
+
+type OutlierDetectionConfig struct {
+	ConsecutiveFailures  int
+	ConsecutiveTimeouts  int
+	ErrorRatePercent     int
+	ErrorRateMinRequests int
+	IntervalSeconds      int
+	BaseEjectionSeconds  int
+	MaxEjectionSeconds   int
+	MaxEjectionPercent   int
+}
+
+type ConsistentHashConfig struct {
+	KeySource    string
+	KeyName      string
+	VirtualNodes int
+}
+
+type LatencyAwareConfig struct {
+	SmoothingFactor      float64
+	ExplorationPercent   int
+	FailurePenaltyMillis int
 }
 
 type Host struct {
-	Address            string
-	Healthy            bool
-	RecentHealthChecks []bool
+	ID                 string             `json:"id"`
+	Address            string             `json:"address"`
+	Weight             int                `json:"weight"`
+	Origin             string             `json:"origin"`
+	Healthy            bool               `json:"healthy"`
+	Metadata           map[string]string  `json:"metadata"`
+	RecentHealthChecks []bool             `json:"recentHealthChecks"`
+	RegisteredAt       time.Time          `json:"registeredAt"`
+	LastHealthCheck    *HealthCheckResult `json:"lastHealthCheck"`
+	Forwarding         ForwardingStats    `json:"forwarding"`
+	Ejected            bool               `json:"ejected"`
+	EjectedUntil       *time.Time         `json:"ejectedUntil,omitempty"`
+	LeaseTtlSeconds    int                `json:"leaseTtlSeconds,omitempty"`
+	LeaseExpiresAt     *time.Time         `json:"leaseExpiresAt,omitempty"`
+}
+
+// HostSpec describes a host to register. The ID is generated when empty and a zero weight stands for
+// the default weight. A positive TtlSeconds registers the host with a lease. Origin tells which source
+// registered the host and is set by the router.
+type HostSpec struct {
+	ID         string            `json:"id"`
+	Address    string            `json:"address"`
+	Weight     int               `json:"weight"`
+	Metadata   map[string]string `json:"metadata"`
+	TtlSeconds int               `json:"ttlSeconds,omitempty"`
+	Origin     string            `json:"origin,omitempty"`
+}
+
+// HostPatch holds the host attributes to change. Metadata entries are merged into the existing ones,
+// with null values removing the entry. A zero TtlSeconds removes the lease of the host.
+type HostPatch struct {
+	Weight     *int               `json:"weight"`
+	Metadata   map[string]*string `json:"metadata"`
+	TtlSeconds *int               `json:"ttlSeconds"`
+}
+
+// HostBatch registers and deregisters hosts, referenced by ID or address, in a single operation.
+type HostBatch struct {
+	Register   []HostSpec `json:"register"`
+	Deregister []string   `json:"deregister"`
+}
+
+type HealthCheckResult struct {
+	CheckedAt     time.Time `json:"checkedAt"`
+	LatencyMillis int64     `json:"latencyMillis"`
+	Error         string    `json:"error,omitempty"`
+}
+
+type ForwardingStats struct {
+	Requests        int64      `json:"requests"`
+	Failures        int64      `json:"failures"`
+	Timeouts        int64      `json:"timeouts"`
+	Cancelled       int64      `json:"cancelled"`
+	LastForwardedAt *time.Time `json:"lastForwardedAt"`
 }
 
 type HandlerResponse struct {
@@ -13,5 +13,13 @@ type RequestRouter interface {
 type Handler interface {
 	RegisterHost(c *gin.Context)
 	DeregisterHost(c *gin.Context)
+	Heartbeat(c *gin.Context)
+	ListHosts(c *gin.Context)
+	GetHost(c *gin.Context)
+	ReplaceHosts(c *gin.Context)
+	UpdateHost(c *gin.Context)
+	RemoveHost(c *gin.Context)
+	ApplyHostBatch(c *gin.Context)
 	ForwardRequest(c *gin.Context)
+	HealthSummary() map[string]any
 }
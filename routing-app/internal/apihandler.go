@@ -2,14 +2,33 @@ package internal
 
 import (
 	"andrewsaputra/routing-app/api"
+	"context"
+	"errors"
+	"fmt"
 	"io"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
+const (
+	requestIdHeader = "X-Request-Id"
+
+	// statusClientClosedRequest is reported when the client went away before a response was available.
+	statusClientClosedRequest = 499
+)
+
 type ModifyHostRequest struct {
 	HostAddress string
+	Weight      int
+	TtlSeconds  int
+}
+
+type ReplaceHostsRequest struct {
+	Hosts []api.HostSpec
 }
 
 func ConstructApiHandler(hostManager *HostManager, requestRouter api.RequestRouter) *ApiHandler {
@@ -35,7 +54,38 @@ func (this *ApiHandler) RegisterHost(c *gin.Context) {
 		return
 	}
 
-	this.handleResponse(c, this.HostManager.RegisterHost(body.HostAddress))
+	weight := body.Weight
+	if weight == 0 {
+		weight = defaultHostWeight
+	}
+
+	ttlSeconds := body.TtlSeconds
+	if ttlSeconds == 0 {
+		ttlSeconds = this.HostManager.DefaultLeaseTtlSeconds()
+	}
+
+	if ttlSeconds != 0 {
+		this.handleResponse(c, this.HostManager.RegisterLeasedHost(body.HostAddress, weight, ttlSeconds))
+		return
+	}
+
+	this.handleResponse(c, this.HostManager.RegisterWeightedHost(body.HostAddress, weight))
+}
+
+// Heartbeat renews the lease of a host registered with a ttl. Unknown hosts are answered with 404, so a
+// host whose lease already lapsed knows it has to register again.
+func (this *ApiHandler) Heartbeat(c *gin.Context) {
+	var body ModifyHostRequest
+	err := c.BindJSON(&body)
+	if err != nil {
+		this.handleResponse(c, api.HandlerResponse{
+			Code:    http.StatusBadRequest,
+			Message: "bad payload request",
+		})
+		return
+	}
+
+	this.handleResponse(c, this.HostManager.RenewLease(body.HostAddress))
 }
 
 func (this *ApiHandler) DeregisterHost(c *gin.Context) {
@@ -52,24 +102,164 @@ func (this *ApiHandler) DeregisterHost(c *gin.Context) {
 	this.handleResponse(c, this.HostManager.DeregisterHost(body.HostAddress))
 }
 
+func (this *ApiHandler) ListHosts(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"hosts": this.HostManager.GetHosts()})
+}
+
+// GetHost looks up a host by the ID or address given after /hosts/, e.g. /hosts/http://localhost:4001.
+// The address may be url encoded.
+func (this *ApiHandler) GetHost(c *gin.Context) {
+	host, ok := this.HostManager.GetHost(hostRef(c))
+	if !ok {
+		this.handleResponse(c, api.HandlerResponse{
+			Code:    http.StatusNotFound,
+			Message: "Host not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, host)
+}
+
+func (this *ApiHandler) ReplaceHosts(c *gin.Context) {
+	var body ReplaceHostsRequest
+	err := c.BindJSON(&body)
+	if err != nil || body.Hosts == nil {
+		this.handleResponse(c, api.HandlerResponse{
+			Code:    http.StatusBadRequest,
+			Message: "bad payload request",
+		})
+		return
+	}
+
+	this.handleResponse(c, this.HostManager.ReplaceHosts(body.Hosts))
+}
+
+func (this *ApiHandler) UpdateHost(c *gin.Context) {
+	var body api.HostPatch
+	err := c.BindJSON(&body)
+	if err != nil {
+		this.handleResponse(c, api.HandlerResponse{
+			Code:    http.StatusBadRequest,
+			Message: "bad payload request",
+		})
+		return
+	}
+
+	this.handleResponse(c, this.HostManager.UpdateHost(hostRef(c), body))
+}
+
+func (this *ApiHandler) RemoveHost(c *gin.Context) {
+	this.handleResponse(c, this.HostManager.RemoveHost(hostRef(c)))
+}
+
+func (this *ApiHandler) ApplyHostBatch(c *gin.Context) {
+	var body api.HostBatch
+	err := c.BindJSON(&body)
+	if err != nil {
+		this.handleResponse(c, api.HandlerResponse{
+			Code:    http.StatusBadRequest,
+			Message: "bad payload request",
+		})
+		return
+	}
+
+	this.handleResponse(c, this.HostManager.ApplyHostBatch(body))
+}
+
 func (this *ApiHandler) ForwardRequest(c *gin.Context) {
+	requestId := c.GetHeader(requestIdHeader)
+	if requestId == "" {
+		requestId = generateId(16)
+		c.Request.Header.Set(requestIdHeader, requestId)
+	}
+
 	resp, err := this.RequestRouter.ForwardRequest(c.Request)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		this.handleForwardingError(c, requestId, err)
 		return
 	}
 
 	defer resp.Body.Close()
+	this.writeUpstreamResponse(c, resp)
+}
+
+func (this *ApiHandler) HealthSummary() map[string]any {
+	return this.HostManager.HealthSummary()
+}
+
+// Private Functions
+
+// handleForwardingError answers with gateway semantics : 503 when no host can take the request, 504 when
+// hosts didn't answer in time and 502 when they couldn't be reached.
+func (this *ApiHandler) handleForwardingError(c *gin.Context, requestId string, err error) {
+	attempts := []string{}
+	var forwardingErr *ForwardingError
+	if errors.As(err, &forwardingErr) {
+		attempts = forwardingErr.Attempts
+	}
+
+	if len(attempts) > 0 {
+		c.Header(routingAttemptsHeader, strings.Join(attempts, ", "))
+	}
+	c.Header(requestIdHeader, requestId)
 
-	body, err := io.ReadAll(resp.Body)
+	status, code := http.StatusInternalServerError, "INTERNAL_ERROR"
+	switch {
+	case errors.Is(err, errNoAvailableHosts):
+		status, code = http.StatusServiceUnavailable, "NO_AVAILABLE_HOSTS"
+		retryAfter := this.HostManager.RetryAfter()
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	case errors.Is(err, errUpstreamTimeout), errors.Is(err, context.DeadlineExceeded):
+		status, code = http.StatusGatewayTimeout, "UPSTREAM_TIMEOUT"
+	case errors.Is(err, context.Canceled):
+		status, code = statusClientClosedRequest, "CLIENT_CLOSED_REQUEST"
+	case errors.Is(err, errForwardingFailed):
+		status, code = http.StatusBadGateway, "UPSTREAM_FAILED"
+	}
+
+	c.JSON(status, gin.H{
+		"code":      code,
+		"message":   err.Error(),
+		"requestId": requestId,
+		"attempts":  attempts,
+	})
+}
+
+// writeUpstreamResponse relays status, end to end headers, body and trailers of the upstream response.
+// The body is copied straight to the client instead of being read into memory first.
+func (this *ApiHandler) writeUpstreamResponse(c *gin.Context, resp *http.Response) {
+	header := c.Writer.Header()
+	removeHopByHopHeaders(resp.Header)
+	copyHeader(header, resp.Header)
+
+	announcedTrailers := map[string]bool{}
+	trailerKeys := make([]string, 0, len(resp.Trailer))
+	for key := range resp.Trailer {
+		announcedTrailers[key] = true
+		trailerKeys = append(trailerKeys, key)
+	}
+	if len(trailerKeys) > 0 {
+		header.Add("Trailer", strings.Join(trailerKeys, ", "))
+	}
+
+	c.Status(resp.StatusCode)
+	c.Writer.WriteHeaderNow()
+	_, err := io.Copy(c.Writer, resp.Body)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		fmt.Println("failed copying upstream response :", err)
 		return
 	}
-	c.Data(resp.StatusCode, resp.Header.Get("Content-Type"), body)
-}
 
-// Private Functions
+	// trailer values are only known once the body has been fully read
+	for key, values := range resp.Trailer {
+		if announcedTrailers[key] {
+			header[key] = values
+		} else {
+			header[http.TrailerPrefix+key] = values
+		}
+	}
+}
 
 func (this *ApiHandler) handleResponse(c *gin.Context, response api.HandlerResponse) {
 	if response.Error != nil {
@@ -79,3 +269,8 @@ func (this *ApiHandler) handleResponse(c *gin.Context, response api.HandlerRespo
 
 	c.JSON(response.Code, gin.H{"message": response.Message})
 }
+
+// hostRef returns the host ID or address given in the catch all route parameter.
+func hostRef(c *gin.Context) string {
+	return strings.TrimPrefix(c.Param("ref"), "/")
+}
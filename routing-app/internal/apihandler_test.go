@@ -0,0 +1,374 @@
+package internal
+
+import (
+	"andrewsaputra/routing-app/api"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestApiHandlerForwardRequest_UpstreamResponse_StreamedToClient(t *testing.T) {
+	payload := strings.Repeat(`{"key":"value"}`, 1000)
+	requestRouter := new(MockRequestRouter)
+	requestRouter.On("ForwardRequest", mock.Anything).Return(&http.Response{
+		StatusCode:    http.StatusCreated,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          io.NopCloser(strings.NewReader(payload)),
+		ContentLength: int64(len(payload)),
+	}, nil)
+	router := Helper_ConstructGinRouter(requestRouter)
+
+	response := httptest.NewRecorder()
+	request, _ := http.NewRequest("POST", "/echojson", strings.NewReader(payload))
+	router.ServeHTTP(response, request)
+
+	assert.Equal(t, http.StatusCreated, response.Code)
+	assert.Equal(t, "application/json", response.Header().Get("Content-Type"))
+	assert.Equal(t, payload, response.Body.String())
+}
+
+func TestApiHandlerForwardRequest_UpstreamHeadersAndTrailers_RelayedFaithfully(t *testing.T) {
+	upstreamHeader := http.Header{}
+	upstreamHeader.Add("Set-Cookie", "a=1")
+	upstreamHeader.Add("Set-Cookie", "b=2")
+	upstreamHeader.Set("Cache-Control", "no-store")
+	upstreamHeader.Set("Connection", "X-Upstream-Hop")
+	upstreamHeader.Set("X-Upstream-Hop", "1")
+	upstreamHeader.Set("Keep-Alive", "timeout=5")
+
+	body := &TrailerSettingBody{reader: strings.NewReader("done")}
+	resp := &http.Response{
+		StatusCode: http.StatusAccepted,
+		Header:     upstreamHeader,
+		Body:       body,
+		Trailer:    http.Header{"X-Checksum": nil},
+	}
+	body.trailer = resp.Trailer
+
+	requestRouter := new(MockRequestRouter)
+	requestRouter.On("ForwardRequest", mock.Anything).Return(resp, nil)
+	router := Helper_ConstructGinRouter(requestRouter)
+
+	response := httptest.NewRecorder()
+	request, _ := http.NewRequest("GET", "/echojson?gamer=GYUTDTE", nil)
+	router.ServeHTTP(response, request)
+
+	result := response.Result()
+	assert.Equal(t, http.StatusAccepted, result.StatusCode)
+	assert.Equal(t, []string{"a=1", "b=2"}, result.Header.Values("Set-Cookie"))
+	assert.Equal(t, "no-store", result.Header.Get("Cache-Control"))
+	assert.Empty(t, result.Header.Get("X-Upstream-Hop"))
+	assert.Empty(t, result.Header.Get("Keep-Alive"))
+	assert.Equal(t, "done", response.Body.String())
+	assert.Equal(t, "abc123", result.Trailer.Get("X-Checksum"))
+}
+
+func TestApiHandlerForwardRequest_RouterError_ReturnStatusError(t *testing.T) {
+	requestRouter := new(MockRequestRouter)
+	requestRouter.On("ForwardRequest", mock.Anything).Return(nil, errors.New("unexpected failure"))
+	router := Helper_ConstructGinRouter(requestRouter)
+
+	response := httptest.NewRecorder()
+	request, _ := http.NewRequest("POST", "/echojson", strings.NewReader(`{}`))
+	router.ServeHTTP(response, request)
+
+	assert.Equal(t, http.StatusInternalServerError, response.Code)
+}
+
+func TestApiHandlerForwardRequest_NoAvailableHosts_ReturnServiceUnavailable(t *testing.T) {
+	requestRouter := new(MockRequestRouter)
+	requestRouter.On("ForwardRequest", mock.Anything).Return(nil, &ForwardingError{Err: errNoAvailableHosts, Attempts: []string{}})
+	router := Helper_ConstructGinRouter(requestRouter)
+
+	response := httptest.NewRecorder()
+	request, _ := http.NewRequest("GET", "/echojson", nil)
+	router.ServeHTTP(response, request)
+
+	assert.Equal(t, http.StatusServiceUnavailable, response.Code)
+	assert.Equal(t, "1", response.Header().Get("Retry-After"))
+
+	body := Helper_DecodeGatewayError(t, response)
+	assert.Equal(t, "NO_AVAILABLE_HOSTS", body.Code)
+	assert.Equal(t, errNoAvailableHosts.Error(), body.Message)
+	assert.Empty(t, body.Attempts)
+}
+
+func TestApiHandlerForwardRequest_ForwardingFailed_ReturnBadGateway(t *testing.T) {
+	requestRouter := new(MockRequestRouter)
+	requestRouter.On("ForwardRequest", mock.Anything).
+		Return(nil, &ForwardingError{Err: errForwardingFailed, Attempts: []string{"http://host1", "http://host2"}})
+	router := Helper_ConstructGinRouter(requestRouter)
+
+	response := httptest.NewRecorder()
+	request, _ := http.NewRequest("GET", "/echojson", nil)
+	request.Header.Set(requestIdHeader, "req-123")
+	router.ServeHTTP(response, request)
+
+	assert.Equal(t, http.StatusBadGateway, response.Code)
+	assert.Equal(t, "http://host1, http://host2", response.Header().Get(routingAttemptsHeader))
+	assert.Equal(t, "req-123", response.Header().Get(requestIdHeader))
+
+	body := Helper_DecodeGatewayError(t, response)
+	assert.Equal(t, "UPSTREAM_FAILED", body.Code)
+	assert.Equal(t, "req-123", body.RequestId)
+	assert.Equal(t, []string{"http://host1", "http://host2"}, body.Attempts)
+}
+
+func TestApiHandlerForwardRequest_UpstreamTimeout_ReturnGatewayTimeout(t *testing.T) {
+	for _, err := range []error{
+		&ForwardingError{Err: errUpstreamTimeout, Attempts: []string{"http://host1"}},
+		&ForwardingError{Err: context.DeadlineExceeded, Attempts: []string{"http://host1"}},
+	} {
+		requestRouter := new(MockRequestRouter)
+		requestRouter.On("ForwardRequest", mock.Anything).Return(nil, err)
+		router := Helper_ConstructGinRouter(requestRouter)
+
+		response := httptest.NewRecorder()
+		request, _ := http.NewRequest("GET", "/echojson", nil)
+		router.ServeHTTP(response, request)
+
+		assert.Equal(t, http.StatusGatewayTimeout, response.Code)
+		assert.Equal(t, "UPSTREAM_TIMEOUT", Helper_DecodeGatewayError(t, response).Code)
+	}
+}
+
+func TestApiHandlerForwardRequest_MissingRequestId_GeneratedAndForwarded(t *testing.T) {
+	requestRouter := new(MockRequestRouter)
+	requestRouter.On("ForwardRequest", mock.Anything).Return(nil, &ForwardingError{Err: errForwardingFailed})
+	router := Helper_ConstructGinRouter(requestRouter)
+
+	response := httptest.NewRecorder()
+	request, _ := http.NewRequest("GET", "/echojson", nil)
+	router.ServeHTTP(response, request)
+
+	forwarded := requestRouter.Calls[0].Arguments.Get(0).(*http.Request)
+	requestId := forwarded.Header.Get(requestIdHeader)
+	assert.Len(t, requestId, 32)
+	assert.Equal(t, requestId, Helper_DecodeGatewayError(t, response).RequestId)
+}
+
+func TestApiHandlerListHosts_HostsRegistered_ReturnAllHosts(t *testing.T) {
+	hostManager := Helper_ConstructHostManager()
+	hostManager.RegisterHost("http://localhost:4001")
+	hostManager.RegisterWeightedHost("http://localhost:4002", 3)
+	router := Helper_ConstructAdminRouter(hostManager)
+
+	response := httptest.NewRecorder()
+	request, _ := http.NewRequest("GET", "/hosts", nil)
+	router.ServeHTTP(response, request)
+
+	var body struct {
+		Hosts []api.Host
+	}
+	json.Unmarshal(response.Body.Bytes(), &body)
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Len(t, body.Hosts, 2)
+	assert.Equal(t, "http://localhost:4002", body.Hosts[1].Address)
+	assert.Equal(t, 3, body.Hosts[1].Weight)
+}
+
+func TestApiHandlerGetHost_ByAddress_ReturnHost(t *testing.T) {
+	hostManager := Helper_ConstructHostManager()
+	hostManager.RegisterHost("http://localhost:4001")
+	router := Helper_ConstructAdminRouter(hostManager)
+
+	for _, path := range []string{"/hosts/http://localhost:4001", "/hosts/" + url.PathEscape("http://localhost:4001")} {
+		response := httptest.NewRecorder()
+		request, _ := http.NewRequest("GET", path, nil)
+		router.ServeHTTP(response, request)
+
+		var host map[string]any
+		json.Unmarshal(response.Body.Bytes(), &host)
+
+		assert.Equal(t, http.StatusOK, response.Code)
+		assert.Equal(t, "http://localhost:4001", host["address"])
+		assert.Contains(t, host, "forwarding")
+		assert.Contains(t, host, "lastHealthCheck")
+	}
+}
+
+func TestApiHandlerGetHost_UnknownAddress_ReturnNotFound(t *testing.T) {
+	router := Helper_ConstructAdminRouter(Helper_ConstructHostManager())
+
+	response := httptest.NewRecorder()
+	request, _ := http.NewRequest("GET", "/hosts/http://localhost:4001", nil)
+	router.ServeHTTP(response, request)
+
+	assert.Equal(t, http.StatusNotFound, response.Code)
+}
+
+func TestApiHandlerReplaceHosts_ValidPayload_PoolReplaced(t *testing.T) {
+	hostManager := Helper_ConstructHostManager()
+	hostManager.RegisterHost("http://localhost:4001")
+	router := Helper_ConstructAdminRouter(hostManager)
+
+	payload := `{"hosts" : [{"id" : "host-2", "address" : "http://localhost:4002", "weight" : 2}]}`
+	response := httptest.NewRecorder()
+	request, _ := http.NewRequest("PUT", "/hosts", strings.NewReader(payload))
+	router.ServeHTTP(response, request)
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	hosts := hostManager.GetHosts()
+	assert.Len(t, hosts, 1)
+	assert.Equal(t, "host-2", hosts[0].ID)
+}
+
+func TestApiHandlerReplaceHosts_MissingHosts_ReturnBadRequest(t *testing.T) {
+	hostManager := Helper_ConstructHostManager()
+	hostManager.RegisterHost("http://localhost:4001")
+	router := Helper_ConstructAdminRouter(hostManager)
+
+	response := httptest.NewRecorder()
+	request, _ := http.NewRequest("PUT", "/hosts", strings.NewReader(`{}`))
+	router.ServeHTTP(response, request)
+
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Len(t, hostManager.GetHosts(), 1)
+}
+
+func TestApiHandlerHostResource_PatchBatchDelete_Applied(t *testing.T) {
+	hostManager := Helper_ConstructHostManager()
+	hostManager.ReplaceHosts([]api.HostSpec{{ID: "host-1", Address: "http://localhost:4001"}})
+	router := Helper_ConstructAdminRouter(hostManager)
+
+	response := httptest.NewRecorder()
+	request, _ := http.NewRequest("PATCH", "/hosts/host-1", strings.NewReader(`{"weight" : 4, "metadata" : {"zone" : "b"}}`))
+	router.ServeHTTP(response, request)
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	host, _ := hostManager.GetHost("host-1")
+	assert.Equal(t, 4, host.Weight)
+	assert.Equal(t, "b", host.Metadata["zone"])
+
+	payload := `{"register" : [{"address" : "http://localhost:4002"}, {"address" : "http://localhost:4003"}], "deregister" : ["host-1"]}`
+	response = httptest.NewRecorder()
+	request, _ = http.NewRequest("POST", "/hosts/batch", strings.NewReader(payload))
+	router.ServeHTTP(response, request)
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Len(t, hostManager.GetHosts(), 2)
+
+	response = httptest.NewRecorder()
+	request, _ = http.NewRequest("DELETE", "/hosts/"+url.PathEscape("http://localhost:4002"), nil)
+	router.ServeHTTP(response, request)
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	hosts := hostManager.GetHosts()
+	assert.Len(t, hosts, 1)
+	assert.Equal(t, "http://localhost:4003", hosts[0].Address)
+}
+
+func TestApiHandlerHeartbeat_LeasedHost_LeaseRenewed(t *testing.T) {
+	hostManager := Helper_ConstructHostManager()
+	router := Helper_ConstructAdminRouter(hostManager)
+
+	response := httptest.NewRecorder()
+	request, _ := http.NewRequest("POST", "/registerhost", strings.NewReader(`{"hostAddress" : "http://localhost:4001", "ttlSeconds" : 10}`))
+	router.ServeHTTP(response, request)
+	assert.Equal(t, http.StatusOK, response.Code)
+	host, _ := hostManager.GetHost("http://localhost:4001")
+	registeredUntil := *host.LeaseExpiresAt
+
+	response = httptest.NewRecorder()
+	request, _ = http.NewRequest("POST", "/heartbeat", strings.NewReader(`{"hostAddress" : "http://localhost:4001"}`))
+	router.ServeHTTP(response, request)
+	assert.Equal(t, http.StatusOK, response.Code)
+	host, _ = hostManager.GetHost("http://localhost:4001")
+	assert.False(t, host.LeaseExpiresAt.Before(registeredUntil))
+
+	response = httptest.NewRecorder()
+	request, _ = http.NewRequest("POST", "/heartbeat", strings.NewReader(`{"hostAddress" : "http://localhost:4002"}`))
+	router.ServeHTTP(response, request)
+	assert.Equal(t, http.StatusNotFound, response.Code)
+
+	response = httptest.NewRecorder()
+	request, _ = http.NewRequest("POST", "/registerhost", strings.NewReader(`{"hostAddress" : "http://localhost:4002", "ttlSeconds" : -1}`))
+	router.ServeHTTP(response, request)
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+}
+
+func TestApiHandlerRegisterHost_DefaultLeaseTtl_HostLeased(t *testing.T) {
+	hostManager, _ := ConstructHostManager(Helper_ConstructMockHttpClient(), Helper_ConstructHealthCheckConfig(), api.HostLeaseConfig{DefaultTtlSeconds: 30}, nil)
+	router := Helper_ConstructAdminRouter(hostManager)
+
+	response := httptest.NewRecorder()
+	request, _ := http.NewRequest("POST", "/registerhost", strings.NewReader(`{"hostAddress" : "http://localhost:4001"}`))
+	router.ServeHTTP(response, request)
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	host, _ := hostManager.GetHost("http://localhost:4001")
+	assert.Equal(t, 30, host.LeaseTtlSeconds)
+}
+
+func Helper_ConstructAdminRouter(hostManager *HostManager) *gin.Engine {
+	handler := ConstructApiHandler(hostManager, new(MockRequestRouter))
+	router := gin.New()
+	router.POST("/registerhost", handler.RegisterHost)
+	router.POST("/heartbeat", handler.Heartbeat)
+	router.GET("/hosts", handler.ListHosts)
+	router.PUT("/hosts", handler.ReplaceHosts)
+	router.POST("/hosts/batch", handler.ApplyHostBatch)
+	router.GET("/hosts/*ref", handler.GetHost)
+	router.PATCH("/hosts/*ref", handler.UpdateHost)
+	router.DELETE("/hosts/*ref", handler.RemoveHost)
+	return router
+}
+
+type GatewayErrorBody struct {
+	Code      string
+	Message   string
+	RequestId string
+	Attempts  []string
+}
+
+func Helper_DecodeGatewayError(t *testing.T, response *httptest.ResponseRecorder) GatewayErrorBody {
+	var body GatewayErrorBody
+	err := json.Unmarshal(response.Body.Bytes(), &body)
+	assert.NoError(t, err)
+	return body
+}
+
+type MockRequestRouter struct {
+	mock.Mock
+}
+
+func (this *MockRequestRouter) ForwardRequest(req *http.Request) (*http.Response, error) {
+	args := this.Called(req)
+	resp, _ := args.Get(0).(*http.Response)
+	return resp, args.Error(1)
+}
+
+func Helper_ConstructGinRouter(requestRouter *MockRequestRouter) *gin.Engine {
+	handler := ConstructApiHandler(Helper_ConstructHostManager(), requestRouter)
+	router := gin.New()
+	router.NoRoute(handler.ForwardRequest)
+	return router
+}
+
+// TrailerSettingBody fills the trailer values once the body is fully read, like net/http does.
+type TrailerSettingBody struct {
+	reader  io.Reader
+	trailer http.Header
+}
+
+func (this *TrailerSettingBody) Read(p []byte) (int, error) {
+	n, err := this.reader.Read(p)
+	if err == io.EOF {
+		this.trailer.Set("X-Checksum", "abc123")
+	}
+	return n, err
+}
+
+func (this *TrailerSettingBody) Close() error {
+	return nil
+}
@@ -0,0 +1,207 @@
+package internal
+
+import (
+	"andrewsaputra/routing-app/api"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	KeySourceHeader    = "Header"
+	KeySourceCookie    = "Cookie"
+	KeySourceJsonField = "JsonField"
+
+	defaultVirtualNodes = 100
+)
+
+func ConstructConsistentHashRouter(client *http.Client, hostManager *HostManager, requestHandling api.RequestHandlingConfig, config api.ConsistentHashConfig) (*ConsistentHashRouter, error) {
+	switch config.KeySource {
+	case KeySourceHeader, KeySourceCookie, KeySourceJsonField:
+	default:
+		return nil, fmt.Errorf("unsupported consistent hash key source %q", config.KeySource)
+	}
+
+	if config.KeyName == "" {
+		return nil, fmt.Errorf("consistent hash key name is required")
+	}
+
+	virtualNodes := config.VirtualNodes
+	if virtualNodes <= 0 {
+		virtualNodes = defaultVirtualNodes
+	}
+
+	return &ConsistentHashRouter{
+		forwarder:     constructRequestForwarder(client, hostManager, requestHandling),
+		keySource:     config.KeySource,
+		keyName:       config.KeyName,
+		virtualNodes:  virtualNodes,
+		ring:          []ringNode{},
+		fallbackIndex: 0,
+	}, nil
+}
+
+type ConsistentHashRouter struct {
+	forwarder     *requestForwarder
+	keySource     string
+	keyName       string
+	virtualNodes  int
+	ring          []ringNode
+	ringHosts     string
+	fallbackIndex int
+	lock          sync.Mutex
+}
+
+type ringNode struct {
+	hash    uint64
+	address string
+}
+
+func (this *ConsistentHashRouter) ForwardRequest(req *http.Request) (*http.Response, error) {
+	key, err := this.extractKey(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if key == "" {
+		return this.forwarder.forward(req, this.selectFallbackHost, nil)
+	}
+
+	return this.forwarder.forward(req, func(hosts []api.Host, tried map[string]bool) string {
+		return this.selectHostForKey(key, hosts, tried)
+	}, nil)
+}
+
+// selectHostForKey returns the owner of the key on the ring. Once the owner has been tried, retries walk
+// further clockwise so a failing owner always hands over to the same successor.
+func (this *ConsistentHashRouter) selectHostForKey(key string, hosts []api.Host, tried map[string]bool) string {
+	ring := this.getRing(hosts)
+	keyHash := hashKey(key)
+	start := sort.Search(len(ring), func(i int) bool {
+		return ring[i].hash >= keyHash
+	})
+
+	for i := 0; i < len(ring); i++ {
+		node := ring[(start+i)%len(ring)]
+		if !tried[node.address] {
+			return node.address
+		}
+	}
+
+	return ring[start%len(ring)].address
+}
+
+// selectFallbackHost is used for requests without a routing key, which have no affinity to keep.
+func (this *ConsistentHashRouter) selectFallbackHost(hosts []api.Host, tried map[string]bool) string {
+	hosts = untriedHosts(hosts, tried)
+
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if this.fallbackIndex >= len(hosts) {
+		this.fallbackIndex = 0
+	}
+
+	host := hosts[this.fallbackIndex]
+	this.fallbackIndex++
+	return host.Address
+}
+
+// getRing returns the ring for the given hosts, rebuilding it only when the host list has changed.
+func (this *ConsistentHashRouter) getRing(hosts []api.Host) []ringNode {
+	addresses := make([]string, len(hosts))
+	for i, host := range hosts {
+		addresses[i] = host.Address
+	}
+	sort.Strings(addresses)
+	ringHosts := strings.Join(addresses, "\n")
+
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if ringHosts == this.ringHosts {
+		return this.ring
+	}
+
+	ring := make([]ringNode, 0, len(addresses)*this.virtualNodes)
+	for _, address := range addresses {
+		for i := 0; i < this.virtualNodes; i++ {
+			ring = append(ring, ringNode{
+				hash:    hashKey(address + "#" + strconv.Itoa(i)),
+				address: address,
+			})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool {
+		return ring[i].hash < ring[j].hash
+	})
+
+	this.ring = ring
+	this.ringHosts = ringHosts
+	return ring
+}
+
+func (this *ConsistentHashRouter) extractKey(req *http.Request) (string, error) {
+	switch this.keySource {
+	case KeySourceHeader:
+		return req.Header.Get(this.keyName), nil
+	case KeySourceCookie:
+		cookie, err := req.Cookie(this.keyName)
+		if err != nil {
+			return "", nil
+		}
+		return cookie.Value, nil
+	default:
+		// payloads larger than the buffer limit are streamed through without a key
+		err := bufferRequestBody(req, this.forwarder.retryBufferBytes)
+		if err != nil || req.GetBody == nil {
+			return "", err
+		}
+
+		body, err := req.GetBody()
+		if err != nil {
+			return "", err
+		}
+		defer body.Close()
+
+		payload, err := io.ReadAll(body)
+		if err != nil {
+			return "", err
+		}
+
+		return extractJsonField(payload, this.keyName), nil
+	}
+}
+
+// extractJsonField returns the value of a top level field, unquoted for strings and as raw json
+// for any other type. Payloads which aren't json objects have no key.
+func extractJsonField(body []byte, field string) string {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return ""
+	}
+
+	raw, ok := fields[field]
+	if !ok {
+		return ""
+	}
+
+	var value string
+	if err := json.Unmarshal(raw, &value); err == nil {
+		return value
+	}
+
+	return string(raw)
+}
+
+func hashKey(key string) uint64 {
+	sum := sha256.Sum256([]byte(key))
+	return binary.BigEndian.Uint64(sum[:8])
+}
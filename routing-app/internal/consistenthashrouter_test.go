@@ -0,0 +1,203 @@
+package internal
+
+import (
+	"andrewsaputra/routing-app/api"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestConstructConsistentHashRouter_UnknownKeySource_ReturnError(t *testing.T) {
+	config := api.ConsistentHashConfig{KeySource: "unknown", KeyName: "gamerID"}
+	router, err := ConstructConsistentHashRouter(Helper_ConstructMockHttpClient(), Helper_ConstructHostManager(), api.RequestHandlingConfig{}, config)
+
+	assert.Nil(t, router)
+	assert.Error(t, err)
+}
+
+func TestSelectHostForKey_SameKey_ReturnSameHost(t *testing.T) {
+	router, hostManager := Helper_ConstructConsistentHashRouter(KeySourceHeader, "X-Gamer-ID")
+	for _, addr := range []string{"host1", "host2", "host3"} {
+		hostManager.RegisterHost(addr)
+	}
+
+	hosts := hostManager.GetEligibleHosts()
+	expected := router.selectHostForKey("GYUTDTE", hosts, nil)
+	for i := 0; i < 10; i++ {
+		target := router.selectHostForKey("GYUTDTE", hosts, nil)
+		assert.Equal(t, expected, target)
+	}
+}
+
+func TestSelectHostForKey_ManyKeys_SpreadAcrossHosts(t *testing.T) {
+	router, hostManager := Helper_ConstructConsistentHashRouter(KeySourceHeader, "X-Gamer-ID")
+	hostAddresses := []string{"host1", "host2", "host3"}
+	for _, addr := range hostAddresses {
+		hostManager.RegisterHost(addr)
+	}
+
+	hosts := hostManager.GetEligibleHosts()
+	counts := map[string]int{}
+	for i := 0; i < 3000; i++ {
+		target := router.selectHostForKey(fmt.Sprint("gamer-", i), hosts, nil)
+		counts[target]++
+	}
+
+	for _, addr := range hostAddresses {
+		assert.Greater(t, counts[addr], 600)
+	}
+}
+
+func TestSelectHostForKey_HostAdded_OnlyFewKeysMoved(t *testing.T) {
+	router, hostManager := Helper_ConstructConsistentHashRouter(KeySourceHeader, "X-Gamer-ID")
+	for _, addr := range []string{"host1", "host2", "host3"} {
+		hostManager.RegisterHost(addr)
+	}
+
+	numKeys := 3000
+	before := make([]string, numKeys)
+	hosts := hostManager.GetEligibleHosts()
+	for i := 0; i < numKeys; i++ {
+		before[i] = router.selectHostForKey(fmt.Sprint("gamer-", i), hosts, nil)
+	}
+
+	hostManager.RegisterHost("host4")
+
+	moved := 0
+	hosts = hostManager.GetEligibleHosts()
+	for i := 0; i < numKeys; i++ {
+		target := router.selectHostForKey(fmt.Sprint("gamer-", i), hosts, nil)
+		if target != before[i] {
+			assert.Equal(t, "host4", target)
+			moved++
+		}
+	}
+
+	// ideally a quarter of the keys move to the new host
+	assert.Greater(t, moved, numKeys/8)
+	assert.Less(t, moved, numKeys/2)
+}
+
+func TestSelectHostForKey_OwnerTried_ReturnNextDistinctHosts(t *testing.T) {
+	router, hostManager := Helper_ConstructConsistentHashRouter(KeySourceHeader, "X-Gamer-ID")
+	for _, addr := range []string{"host1", "host2", "host3"} {
+		hostManager.RegisterHost(addr)
+	}
+
+	hosts := hostManager.GetEligibleHosts()
+	tried := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		target := router.selectHostForKey("GYUTDTE", hosts, tried)
+		assert.False(t, tried[target])
+		tried[target] = true
+	}
+	assert.Len(t, tried, 3)
+
+	owner := router.selectHostForKey("GYUTDTE", hosts, nil)
+	wrapped := router.selectHostForKey("GYUTDTE", hosts, tried)
+	assert.Equal(t, owner, wrapped)
+
+	successor := router.selectHostForKey("GYUTDTE", hosts, map[string]bool{owner: true})
+	for i := 0; i < 5; i++ {
+		target := router.selectHostForKey("GYUTDTE", hosts, map[string]bool{owner: true})
+		assert.Equal(t, successor, target)
+	}
+}
+
+func TestForwardRequest_ConsistentHashNoEligibleHost_ReturnError(t *testing.T) {
+	router, _ := Helper_ConstructConsistentHashRouter(KeySourceHeader, "X-Gamer-ID")
+	request, _ := http.NewRequest("GET", "/test", nil)
+	request.Header.Set("X-Gamer-ID", "GYUTDTE")
+	resp, err := router.ForwardRequest(request)
+
+	assert.Nil(t, resp)
+	assert.ErrorIs(t, err, errNoAvailableHosts)
+}
+
+func TestExtractKey_FromHeaderCookieAndJsonField_ReturnKey(t *testing.T) {
+	headerRouter, _ := Helper_ConstructConsistentHashRouter(KeySourceHeader, "X-Gamer-ID")
+	request, _ := http.NewRequest("POST", "/test", nil)
+	request.Header.Set("X-Gamer-ID", "GYUTDTE")
+	key, err := headerRouter.extractKey(request)
+	assert.NoError(t, err)
+	assert.Equal(t, "GYUTDTE", key)
+
+	cookieRouter, _ := Helper_ConstructConsistentHashRouter(KeySourceCookie, "gamer")
+	request, _ = http.NewRequest("POST", "/test", nil)
+	request.AddCookie(&http.Cookie{Name: "gamer", Value: "GYUTDTE"})
+	key, err = cookieRouter.extractKey(request)
+	assert.NoError(t, err)
+	assert.Equal(t, "GYUTDTE", key)
+
+	jsonRouter, _ := Helper_ConstructConsistentHashRouter(KeySourceJsonField, "gamerID")
+	payload := `{"game":"Mobile Legends", "gamerID":"GYUTDTE", "points":20}`
+	request, _ = http.NewRequest("POST", "/test", bytes.NewReader([]byte(payload)))
+	key, err = jsonRouter.extractKey(request)
+	assert.NoError(t, err)
+	assert.Equal(t, "GYUTDTE", key)
+
+	body, _ := io.ReadAll(request.Body)
+	assert.Equal(t, payload, string(body))
+}
+
+func TestExtractJsonField_NonStringOrMissingField_ReturnRawOrEmpty(t *testing.T) {
+	assert.Equal(t, "20", extractJsonField([]byte(`{"points":20}`), "points"))
+	assert.Equal(t, "", extractJsonField([]byte(`{"points":20}`), "gamerID"))
+	assert.Equal(t, "", extractJsonField([]byte(`not a json`), "gamerID"))
+}
+
+func TestForwardRequest_JsonFieldKey_ForwardSameGamerToSameHost(t *testing.T) {
+	roundTripper := new(MockRoundTripper)
+	roundTripper.On("RoundTrip", mock.Anything).
+		Return(&http.Response{StatusCode: http.StatusOK}, nil)
+	client := &http.Client{
+		Transport: roundTripper,
+	}
+
+	hostManager := Helper_ConstructHostManager()
+	for _, addr := range []string{"http://host1", "http://host2", "http://host3"} {
+		hostManager.RegisterHost(addr)
+	}
+	router, _ := ConstructConsistentHashRouter(client, hostManager, api.RequestHandlingConfig{MaxRetries: 0}, api.ConsistentHashConfig{
+		KeySource: KeySourceJsonField,
+		KeyName:   "gamerID",
+	})
+
+	payload := []byte(`{"game":"Mobile Legends", "gamerID":"GYUTDTE", "points":20}`)
+	for i := 0; i < 5; i++ {
+		request, _ := http.NewRequest("POST", "/echojson", bytes.NewReader(payload))
+		resp, err := router.ForwardRequest(request)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	hosts := map[string]bool{}
+	for _, call := range roundTripper.Calls {
+		upstreamReq := call.Arguments.Get(0).(*http.Request)
+		hosts[upstreamReq.URL.Host] = true
+
+		body, _ := io.ReadAll(upstreamReq.Body)
+		assert.Equal(t, string(payload), string(body))
+	}
+	assert.Len(t, hosts, 1)
+}
+
+func TestForwardRequest_MissingKey_FallbackToRotation(t *testing.T) {
+	router, hostManager := Helper_ConstructConsistentHashRouter(KeySourceHeader, "X-Gamer-ID")
+	hostAddresses := []string{"host1", "host2", "host3"}
+	for _, addr := range hostAddresses {
+		hostManager.RegisterHost(addr)
+	}
+
+	hosts := hostManager.GetEligibleHosts()
+	n := len(hostAddresses)
+	for i := 0; i < 2*n; i++ {
+		target := router.selectFallbackHost(hosts, nil)
+		assert.Equal(t, hostAddresses[i%n], target)
+	}
+}
@@ -0,0 +1,446 @@
+package internal
+
+import (
+	"andrewsaputra/routing-app/api"
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	DnsRecordA   = "A"
+	DnsRecordSrv = "SRV"
+
+	defaultDnsScheme            = "http"
+	defaultDnsServer            = "127.0.0.1:53"
+	defaultDnsTimeoutSeconds    = 2
+	defaultDnsMinRefreshSeconds = 5
+	defaultDnsMaxRefreshSeconds = 300
+	dnsMaxUdpMessageSize        = 65535
+	dnsMaxCnameHops             = 8
+	resolvConfPath              = "/etc/resolv.conf"
+)
+
+func ConstructDnsDiscovery(hostManager *HostManager, config api.DnsDiscoveryConfig) (*DnsDiscovery, error) {
+	recordType := config.RecordType
+	if recordType == "" {
+		recordType = DnsRecordA
+	}
+
+	switch recordType {
+	case DnsRecordA:
+		if config.Port <= 0 || config.Port > 65535 {
+			return nil, errors.New("dns discovery port is required for A records")
+		}
+	case DnsRecordSrv:
+	default:
+		return nil, fmt.Errorf("unsupported dns discovery record type %q", config.RecordType)
+	}
+
+	name, err := dnsName(config.Name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid dns discovery name %q : %w", config.Name, err)
+	}
+
+	scheme := config.Scheme
+	if scheme == "" {
+		scheme = defaultDnsScheme
+	}
+
+	server := config.Server
+	if server == "" {
+		server = systemDnsServer()
+	}
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+
+	timeout := config.TimeoutSeconds
+	if timeout <= 0 {
+		timeout = defaultDnsTimeoutSeconds
+	}
+
+	minRefresh := config.MinRefreshSeconds
+	if minRefresh <= 0 {
+		minRefresh = defaultDnsMinRefreshSeconds
+	}
+
+	maxRefresh := config.MaxRefreshSeconds
+	if maxRefresh <= 0 {
+		maxRefresh = defaultDnsMaxRefreshSeconds
+	}
+	if maxRefresh < minRefresh {
+		maxRefresh = minRefresh
+	}
+
+	return &DnsDiscovery{
+		hostManager: hostManager,
+		name:        name,
+		recordType:  recordType,
+		scheme:      scheme,
+		port:        config.Port,
+		server:      server,
+		timeout:     time.Duration(timeout) * time.Second,
+		minRefresh:  time.Duration(minRefresh) * time.Second,
+		maxRefresh:  time.Duration(maxRefresh) * time.Second,
+	}, nil
+}
+
+// DnsDiscovery keeps the hosts behind a dns name registered. A records (along with AAAA records) resolve
+// to hosts on the configured port, while SRV records give the port and weight of each host. The name is
+// resolved again once the records expire, within [minRefresh, maxRefresh], and hosts which disappeared
+// are deregistered. A failed resolution leaves the pool unchanged and is retried after minRefresh.
+type DnsDiscovery struct {
+	hostManager *HostManager
+	name        dnsmessage.Name
+	recordType  string
+	scheme      string
+	port        int
+	server      string
+	timeout     time.Duration
+	minRefresh  time.Duration
+	maxRefresh  time.Duration
+}
+
+// Sync resolves the name and reconciles the pool, returning the wait before the next resolution.
+func (this *DnsDiscovery) Sync() (time.Duration, error) {
+	specs, ttl, err := this.resolve()
+	if err == nil {
+		err = this.hostManager.SyncHosts(HostOriginDns, specs)
+	}
+	if err != nil {
+		return this.minRefresh, err
+	}
+
+	if ttl < this.minRefresh {
+		return this.minRefresh, nil
+	}
+	if ttl > this.maxRefresh {
+		return this.maxRefresh, nil
+	}
+	return ttl, nil
+}
+
+// Watch resolves the name forever, it's meant to run in its own goroutine.
+func (this *DnsDiscovery) Watch() {
+	var lastErr string
+	for {
+		wait, err := this.Sync()
+		if err == nil {
+			lastErr = ""
+		} else if err.Error() != lastErr {
+			fmt.Println("failed syncing dns hosts :", err)
+			lastErr = err.Error()
+		}
+
+		time.Sleep(wait)
+	}
+}
+
+// Private Functions
+
+// resolve returns the hosts the name currently resolves to, along with the lowest ttl of the records
+// used. The ttl is negative when no record was found.
+func (this *DnsDiscovery) resolve() ([]api.HostSpec, time.Duration, error) {
+	if this.recordType == DnsRecordSrv {
+		return this.resolveSrv()
+	}
+
+	ips, ttl, err := this.lookupAddresses(this.name, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	specs := []api.HostSpec{}
+	for _, ip := range ips {
+		specs = this.appendHost(specs, ip, this.port, defaultHostWeight)
+	}
+	return specs, ttl, nil
+}
+
+// resolveSrv returns the hosts of the SRV records with the lowest priority, the other ones being backups.
+func (this *DnsDiscovery) resolveSrv() ([]api.HostSpec, time.Duration, error) {
+	response, err := this.query(this.name, dnsmessage.TypeSRV)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	records := []dnsmessage.Resource{}
+	for _, answer := range response.Answers {
+		srv, ok := answer.Body.(*dnsmessage.SRVResource)
+		if !ok {
+			continue
+		}
+
+		if len(records) > 0 {
+			lowest := records[0].Body.(*dnsmessage.SRVResource).Priority
+			if srv.Priority > lowest {
+				continue
+			}
+			if srv.Priority < lowest {
+				records = records[:0]
+			}
+		}
+		records = append(records, answer)
+	}
+
+	ttl := time.Duration(-1)
+	specs := []api.HostSpec{}
+	for _, record := range records {
+		srv := record.Body.(*dnsmessage.SRVResource)
+		ttl = lowerTtl(ttl, record.Header.TTL)
+
+		// targets are usually resolved by the server along with the SRV records
+		ips, targetTtl, err := this.lookupAddresses(srv.Target, response.Additionals)
+		if err != nil {
+			return nil, 0, err
+		}
+		if targetTtl >= 0 && targetTtl < ttl {
+			ttl = targetTtl
+		}
+
+		weight := int(srv.Weight)
+		if weight < 1 {
+			weight = 1
+		}
+
+		for _, ip := range ips {
+			specs = this.appendHost(specs, ip, int(srv.Port), weight)
+		}
+	}
+	return specs, ttl, nil
+}
+
+// lookupAddresses returns the A and AAAA records of name, taken from known records when they hold any.
+func (this *DnsDiscovery) lookupAddresses(name dnsmessage.Name, known []dnsmessage.Resource) ([]net.IP, time.Duration, error) {
+	ips, ttl, _ := addressRecords(name, known)
+	if len(ips) > 0 {
+		return ips, ttl, nil
+	}
+
+	for _, recordType := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		found, foundTtl, err := this.queryAddresses(name, recordType)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		ips = append(ips, found...)
+		if foundTtl >= 0 && (ttl < 0 || foundTtl < ttl) {
+			ttl = foundTtl
+		}
+	}
+	return ips, ttl, nil
+}
+
+// queryAddresses returns the address records of name for recordType. CNAME records are followed, querying
+// their target whenever the server didn't resolve it along with the alias.
+func (this *DnsDiscovery) queryAddresses(name dnsmessage.Name, recordType dnsmessage.Type) ([]net.IP, time.Duration, error) {
+	ttl := time.Duration(-1)
+	for i := 0; i < dnsMaxCnameHops; i++ {
+		response, err := this.query(name, recordType)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		ips, foundTtl, target := addressRecords(name, response.Answers)
+		if foundTtl >= 0 && (ttl < 0 || foundTtl < ttl) {
+			ttl = foundTtl
+		}
+		if len(ips) > 0 || target == name {
+			return ips, ttl, nil
+		}
+		name = target
+	}
+	return nil, 0, fmt.Errorf("dns query for %s %s failed : too many cname records", name, recordType)
+}
+
+// query sends a question to the server over udp, then over tcp when the answer was truncated. A name
+// which doesn't exist is an empty answer rather than an error.
+func (this *DnsDiscovery) query(name dnsmessage.Name, recordType dnsmessage.Type) (*dnsmessage.Message, error) {
+	var idBytes [2]byte
+	rand.Read(idBytes[:])
+	id := binary.BigEndian.Uint16(idBytes[:])
+
+	query := dnsmessage.Message{
+		Header: dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{
+			{Name: name, Type: recordType, Class: dnsmessage.ClassINET},
+		},
+	}
+
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := this.exchange("udp", packed, id)
+	if err == nil && response.Truncated {
+		response, err = this.exchange("tcp", packed, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("dns query for %s %s failed : %w", name, recordType, err)
+	}
+
+	switch response.RCode {
+	case dnsmessage.RCodeSuccess, dnsmessage.RCodeNameError:
+		return response, nil
+	default:
+		return nil, fmt.Errorf("dns query for %s %s failed : %s", name, recordType, response.RCode)
+	}
+}
+
+func (this *DnsDiscovery) exchange(network string, packed []byte, id uint16) (*dnsmessage.Message, error) {
+	conn, err := net.DialTimeout(network, this.server, this.timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(this.timeout))
+
+	if network == "tcp" {
+		// messages sent over tcp are prefixed by their length
+		framed := make([]byte, 2+len(packed))
+		binary.BigEndian.PutUint16(framed, uint16(len(packed)))
+		copy(framed[2:], packed)
+		if _, err := conn.Write(framed); err != nil {
+			return nil, err
+		}
+
+		var length [2]byte
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			return nil, err
+		}
+
+		buffer := make([]byte, binary.BigEndian.Uint16(length[:]))
+		if _, err := io.ReadFull(conn, buffer); err != nil {
+			return nil, err
+		}
+
+		var response dnsmessage.Message
+		if err := response.Unpack(buffer); err != nil {
+			return nil, err
+		}
+		if !response.Response || response.ID != id {
+			return nil, errors.New("unexpected dns response")
+		}
+		return &response, nil
+	}
+
+	if _, err := conn.Write(packed); err != nil {
+		return nil, err
+	}
+
+	buffer := make([]byte, dnsMaxUdpMessageSize)
+	for {
+		n, err := conn.Read(buffer)
+		if err != nil {
+			return nil, err
+		}
+
+		// skip malformed or stale datagrams until the deadline
+		var response dnsmessage.Message
+		if response.Unpack(buffer[:n]) != nil || !response.Response || response.ID != id {
+			continue
+		}
+		return &response, nil
+	}
+}
+
+func (this *DnsDiscovery) appendHost(specs []api.HostSpec, ip net.IP, port int, weight int) []api.HostSpec {
+	address := this.scheme + "://" + net.JoinHostPort(ip.String(), strconv.Itoa(port))
+	for _, spec := range specs {
+		if spec.Address == address {
+			return specs
+		}
+	}
+
+	return append(specs, api.HostSpec{
+		Address:  address,
+		Weight:   weight,
+		Metadata: map[string]string{"dnsName": this.name.String()},
+	})
+}
+
+// addressRecords returns the ips held by the A and AAAA records of name, following the CNAME records
+// found along the way, with the lowest ttl of the records used. The last name reached is returned as
+// well, it differs from name when an alias target has no address among records.
+func addressRecords(name dnsmessage.Name, records []dnsmessage.Resource) ([]net.IP, time.Duration, dnsmessage.Name) {
+	ttl := time.Duration(-1)
+	for i := 0; i < dnsMaxCnameHops; i++ {
+		ips := []net.IP{}
+		var alias *dnsmessage.Resource
+		for j, record := range records {
+			if !strings.EqualFold(record.Header.Name.String(), name.String()) {
+				continue
+			}
+
+			switch body := record.Body.(type) {
+			case *dnsmessage.AResource:
+				ips = append(ips, net.IP(body.A[:]))
+			case *dnsmessage.AAAAResource:
+				ips = append(ips, net.IP(body.AAAA[:]))
+			case *dnsmessage.CNAMEResource:
+				alias = &records[j]
+				continue
+			default:
+				continue
+			}
+			ttl = lowerTtl(ttl, record.Header.TTL)
+		}
+
+		if len(ips) > 0 || alias == nil {
+			return ips, ttl, name
+		}
+
+		ttl = lowerTtl(ttl, alias.Header.TTL)
+		name = alias.Body.(*dnsmessage.CNAMEResource).CNAME
+	}
+	return []net.IP{}, ttl, name
+}
+
+func lowerTtl(current time.Duration, ttl uint32) time.Duration {
+	duration := time.Duration(ttl) * time.Second
+	if current < 0 || duration < current {
+		return duration
+	}
+	return current
+}
+
+func dnsName(name string) (dnsmessage.Name, error) {
+	if name == "" {
+		return dnsmessage.Name{}, errors.New("name is required")
+	}
+
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	return dnsmessage.NewName(name)
+}
+
+// systemDnsServer returns the first name server of resolv.conf.
+func systemDnsServer() string {
+	file, err := os.Open(resolvConfPath)
+	if err != nil {
+		return defaultDnsServer
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			return net.JoinHostPort(fields[1], "53")
+		}
+	}
+	return defaultDnsServer
+}
@@ -0,0 +1,354 @@
+package internal
+
+import (
+	"andrewsaputra/routing-app/api"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// FakeDnsServer answers dns queries over udp and tcp from a fixed set of records.
+type FakeDnsServer struct {
+	Address      string
+	records      []dnsmessage.Resource
+	rcode        dnsmessage.RCode
+	additionals  bool
+	chaseCnames  bool
+	truncateUdp  bool
+	queriesByTcp int
+	lock         sync.Mutex
+}
+
+func TestDnsDiscovery_ARecords_RegisterHosts(t *testing.T) {
+	server := Helper_StartDnsServer(t,
+		Helper_ARecord("api.service.local.", "10.0.0.1", 30),
+		Helper_ARecord("api.service.local.", "10.0.0.2", 20),
+		Helper_AAAARecord("api.service.local.", "fd00::1", 60),
+	)
+	mgr := Helper_ConstructHostManager()
+	mgr.RegisterHost("http://localhost:4001")
+	discovery, err := ConstructDnsDiscovery(mgr, api.DnsDiscoveryConfig{Name: "api.service.local", Port: 8080, Server: server.Address, MinRefreshSeconds: 1})
+	assert.NoError(t, err)
+
+	wait, err := discovery.Sync()
+
+	assert.NoError(t, err)
+	assert.Equal(t, 20*time.Second, wait)
+	hosts := mgr.GetHosts()
+	assert.Len(t, hosts, 4)
+	assert.Equal(t, HostOriginApi, hosts[0].Origin)
+	assert.Equal(t, "http://10.0.0.1:8080", hosts[1].Address)
+	assert.Equal(t, "http://10.0.0.2:8080", hosts[2].Address)
+	assert.Equal(t, "http://[fd00::1]:8080", hosts[3].Address)
+	for _, host := range hosts[1:] {
+		assert.Equal(t, HostOriginDns, host.Origin)
+		assert.Equal(t, "api.service.local.", host.Metadata["dnsName"])
+	}
+}
+
+func TestDnsDiscovery_SrvRecords_UseLowestPriorityWeightsAndPorts(t *testing.T) {
+	for _, additionals := range []bool{true, false} {
+		server := Helper_StartDnsServer(t,
+			Helper_SrvRecord("_api._tcp.service.local.", "node1.service.local.", 10, 3, 4001, 60),
+			Helper_SrvRecord("_api._tcp.service.local.", "node2.service.local.", 10, 0, 4002, 60),
+			Helper_SrvRecord("_api._tcp.service.local.", "backup.service.local.", 20, 1, 4003, 60),
+			Helper_ARecord("node1.service.local.", "10.0.0.1", 15),
+			Helper_ARecord("node2.service.local.", "10.0.0.2", 60),
+			Helper_ARecord("backup.service.local.", "10.0.0.3", 60),
+		)
+		server.lock.Lock()
+		server.additionals = additionals
+		server.lock.Unlock()
+		mgr := Helper_ConstructHostManager()
+		discovery, _ := ConstructDnsDiscovery(mgr, api.DnsDiscoveryConfig{Name: "_api._tcp.service.local", RecordType: DnsRecordSrv, Server: server.Address})
+
+		wait, err := discovery.Sync()
+
+		assert.NoError(t, err)
+		assert.Equal(t, 15*time.Second, wait)
+		hosts := mgr.GetHosts()
+		assert.Len(t, hosts, 2)
+		assert.Equal(t, "http://10.0.0.1:4001", hosts[0].Address)
+		assert.Equal(t, 3, hosts[0].Weight)
+		assert.Equal(t, "http://10.0.0.2:4002", hosts[1].Address)
+		assert.Equal(t, 1, hosts[1].Weight)
+	}
+}
+
+func TestDnsDiscovery_CnameRecords_FollowAliasTarget(t *testing.T) {
+	for _, chaseCnames := range []bool{true, false} {
+		server := Helper_StartDnsServer(t,
+			Helper_CnameRecord("api.service.local.", "lb.service.local.", 40),
+			Helper_CnameRecord("lb.service.local.", "node1.service.local.", 30),
+			Helper_ARecord("node1.service.local.", "10.0.0.1", 60),
+			Helper_SrvRecord("_api._tcp.service.local.", "lb.service.local.", 10, 1, 4001, 60),
+		)
+		server.lock.Lock()
+		server.chaseCnames = chaseCnames
+		server.lock.Unlock()
+		mgr := Helper_ConstructHostManager()
+		discovery, _ := ConstructDnsDiscovery(mgr, api.DnsDiscoveryConfig{Name: "api.service.local", Port: 8080, Server: server.Address})
+		srvMgr := Helper_ConstructHostManager()
+		srvDiscovery, _ := ConstructDnsDiscovery(srvMgr, api.DnsDiscoveryConfig{Name: "_api._tcp.service.local", RecordType: DnsRecordSrv, Server: server.Address})
+
+		wait, err := discovery.Sync()
+		assert.NoError(t, err)
+		assert.Equal(t, 30*time.Second, wait)
+		hosts := mgr.GetHosts()
+		assert.Len(t, hosts, 1)
+		assert.Equal(t, "http://10.0.0.1:8080", hosts[0].Address)
+
+		wait, err = srvDiscovery.Sync()
+		assert.NoError(t, err)
+		assert.Equal(t, 30*time.Second, wait)
+		hosts = srvMgr.GetHosts()
+		assert.Len(t, hosts, 1)
+		assert.Equal(t, "http://10.0.0.1:4001", hosts[0].Address)
+	}
+}
+
+func TestDnsDiscovery_RecordRemoved_DeregisterHost(t *testing.T) {
+	server := Helper_StartDnsServer(t,
+		Helper_ARecord("api.service.local.", "10.0.0.1", 1),
+		Helper_ARecord("api.service.local.", "10.0.0.2", 1),
+	)
+	mgr := Helper_ConstructHostManager()
+	discovery, _ := ConstructDnsDiscovery(mgr, api.DnsDiscoveryConfig{Name: "api.service.local", Port: 80, Server: server.Address, MinRefreshSeconds: 1})
+	discovery.Sync()
+	kept, _ := mgr.GetHost("http://10.0.0.2:80")
+
+	server.SetRecords(Helper_ARecord("api.service.local.", "10.0.0.2", 1))
+	_, err := discovery.Sync()
+	assert.NoError(t, err)
+	hosts := mgr.GetHosts()
+	assert.Len(t, hosts, 1)
+	assert.Equal(t, kept.ID, hosts[0].ID)
+
+	// a name which no longer exists has no hosts
+	server.SetRecords()
+	wait, err := discovery.Sync()
+	assert.NoError(t, err)
+	assert.Equal(t, time.Second, wait)
+	assert.Empty(t, mgr.GetHosts())
+}
+
+func TestDnsDiscovery_ServerFailure_PoolUnchanged(t *testing.T) {
+	server := Helper_StartDnsServer(t, Helper_ARecord("api.service.local.", "10.0.0.1", 30))
+	mgr := Helper_ConstructHostManager()
+	discovery, _ := ConstructDnsDiscovery(mgr, api.DnsDiscoveryConfig{Name: "api.service.local", Port: 80, Server: server.Address, MinRefreshSeconds: 2})
+	discovery.Sync()
+
+	server.lock.Lock()
+	server.rcode = dnsmessage.RCodeServerFailure
+	server.lock.Unlock()
+	wait, err := discovery.Sync()
+
+	assert.Error(t, err)
+	assert.Equal(t, 2*time.Second, wait)
+	assert.Len(t, mgr.GetHosts(), 1)
+}
+
+func TestDnsDiscovery_TruncatedResponse_RetryOverTcp(t *testing.T) {
+	server := Helper_StartDnsServer(t, Helper_ARecord("api.service.local.", "10.0.0.1", 30))
+	server.lock.Lock()
+	server.truncateUdp = true
+	server.lock.Unlock()
+	mgr := Helper_ConstructHostManager()
+	discovery, _ := ConstructDnsDiscovery(mgr, api.DnsDiscoveryConfig{Name: "api.service.local", Port: 80, Server: server.Address})
+
+	_, err := discovery.Sync()
+
+	assert.NoError(t, err)
+	assert.Len(t, mgr.GetHosts(), 1)
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	assert.Equal(t, 2, server.queriesByTcp)
+}
+
+func TestConstructDnsDiscovery_InvalidConfig_ReturnError(t *testing.T) {
+	mgr := Helper_ConstructHostManager()
+	for _, config := range []api.DnsDiscoveryConfig{
+		{Name: "api.service.local"},
+		{Name: "api.service.local", Port: 80, RecordType: "MX"},
+		{Name: "", RecordType: DnsRecordSrv},
+	} {
+		_, err := ConstructDnsDiscovery(mgr, config)
+		assert.Error(t, err)
+	}
+}
+
+func Helper_StartDnsServer(t *testing.T, records ...dnsmessage.Resource) *FakeDnsServer {
+	packetConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := net.Listen("tcp", packetConn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &FakeDnsServer{Address: packetConn.LocalAddr().String(), records: records}
+	t.Cleanup(func() {
+		packetConn.Close()
+		listener.Close()
+	})
+
+	go func() {
+		buffer := make([]byte, 512)
+		for {
+			n, addr, err := packetConn.ReadFrom(buffer)
+			if err != nil {
+				return
+			}
+			packetConn.WriteTo(server.answer(buffer[:n], true), addr)
+		}
+	}()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			var length [2]byte
+			io.ReadFull(conn, length[:])
+			query := make([]byte, binary.BigEndian.Uint16(length[:]))
+			io.ReadFull(conn, query)
+
+			server.lock.Lock()
+			server.queriesByTcp++
+			server.lock.Unlock()
+
+			response := server.answer(query, false)
+			framed := make([]byte, 2+len(response))
+			binary.BigEndian.PutUint16(framed, uint16(len(response)))
+			copy(framed[2:], response)
+			conn.Write(framed)
+			conn.Close()
+		}
+	}()
+	return server
+}
+
+func (this *FakeDnsServer) SetRecords(records ...dnsmessage.Resource) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.records = records
+}
+
+func (this *FakeDnsServer) answer(raw []byte, overUdp bool) []byte {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	var query dnsmessage.Message
+	query.Unpack(raw)
+	question := query.Questions[0]
+	response := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: query.ID, Response: true, RCode: this.rcode},
+		Questions: query.Questions,
+	}
+
+	if overUdp && this.truncateUdp {
+		response.Truncated = true
+		packed, _ := response.Pack()
+		return packed
+	}
+
+	name := question.Name.String()
+	nameExists := false
+	for i := 0; i < 8; i++ {
+		alias := ""
+		for _, record := range this.records {
+			if !strings.EqualFold(record.Header.Name.String(), name) {
+				continue
+			}
+			nameExists = true
+			if record.Header.Type == question.Type {
+				response.Answers = append(response.Answers, record)
+			} else if cname, ok := record.Body.(*dnsmessage.CNAMEResource); ok {
+				response.Answers = append(response.Answers, record)
+				alias = cname.CNAME.String()
+			}
+		}
+
+		// recursive servers resolve the alias target along with the alias
+		if alias == "" || !this.chaseCnames {
+			break
+		}
+		name = alias
+	}
+
+	if this.additionals {
+		for _, answer := range response.Answers {
+			if srv, ok := answer.Body.(*dnsmessage.SRVResource); ok {
+				for _, record := range this.records {
+					if record.Header.Name.String() == srv.Target.String() {
+						response.Additionals = append(response.Additionals, record)
+					}
+				}
+			}
+		}
+	}
+
+	if !nameExists && response.RCode == dnsmessage.RCodeSuccess {
+		response.RCode = dnsmessage.RCodeNameError
+	}
+
+	packed, _ := response.Pack()
+	return packed
+}
+
+func Helper_ARecord(name string, ip string, ttl uint32) dnsmessage.Resource {
+	var a [4]byte
+	copy(a[:], net.ParseIP(ip).To4())
+	return dnsmessage.Resource{
+		Header: Helper_ResourceHeader(name, dnsmessage.TypeA, ttl),
+		Body:   &dnsmessage.AResource{A: a},
+	}
+}
+
+func Helper_AAAARecord(name string, ip string, ttl uint32) dnsmessage.Resource {
+	var aaaa [16]byte
+	copy(aaaa[:], net.ParseIP(ip).To16())
+	return dnsmessage.Resource{
+		Header: Helper_ResourceHeader(name, dnsmessage.TypeAAAA, ttl),
+		Body:   &dnsmessage.AAAAResource{AAAA: aaaa},
+	}
+}
+
+func Helper_CnameRecord(name string, target string, ttl uint32) dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: Helper_ResourceHeader(name, dnsmessage.TypeCNAME, ttl),
+		Body:   &dnsmessage.CNAMEResource{CNAME: dnsmessage.MustNewName(target)},
+	}
+}
+
+func Helper_SrvRecord(name string, target string, priority uint16, weight uint16, port uint16, ttl uint32) dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: Helper_ResourceHeader(name, dnsmessage.TypeSRV, ttl),
+		Body: &dnsmessage.SRVResource{
+			Priority: priority,
+			Weight:   weight,
+			Port:     port,
+			Target:   dnsmessage.MustNewName(target),
+		},
+	}
+}
+
+func Helper_ResourceHeader(name string, recordType dnsmessage.Type, ttl uint32) dnsmessage.ResourceHeader {
+	return dnsmessage.ResourceHeader{
+		Name:  dnsmessage.MustNewName(name),
+		Type:  recordType,
+		Class: dnsmessage.ClassINET,
+		TTL:   ttl,
+	}
+}
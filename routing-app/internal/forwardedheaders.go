@@ -0,0 +1,132 @@
+package internal
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ParseTrustedProxies accepts single IP addresses as well as CIDR ranges.
+func ParseTrustedProxies(entries []string) ([]*net.IPNet, error) {
+	result := []*net.IPNet{}
+	for _, entry := range entries {
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", entry)
+			}
+
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+			result = append(result, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", entry)
+		}
+		result = append(result, ipNet)
+	}
+
+	return result, nil
+}
+
+// setForwardedHeaders appends the client to X-Forwarded-For and the RFC 7239 Forwarded header. Forwarding
+// headers received from an untrusted peer can't be relied on, so they are replaced instead of extended.
+func setForwardedHeaders(header http.Header, req *http.Request, trustedProxies []*net.IPNet) {
+	clientIp := remoteIp(req.RemoteAddr)
+	if !isTrustedProxy(clientIp, trustedProxies) {
+		header.Del("X-Forwarded-For")
+		header.Del("X-Forwarded-Proto")
+		header.Del("X-Forwarded-Host")
+		header.Del("Forwarded")
+	}
+
+	proto := "http"
+	if req.TLS != nil {
+		proto = "https"
+	}
+
+	if clientIp != nil {
+		appendHeaderList(header, "X-Forwarded-For", clientIp.String())
+	}
+	if header.Get("X-Forwarded-Proto") == "" {
+		header.Set("X-Forwarded-Proto", proto)
+	}
+	if header.Get("X-Forwarded-Host") == "" && req.Host != "" {
+		header.Set("X-Forwarded-Host", req.Host)
+	}
+
+	forwardedFor := "unknown"
+	if clientIp != nil {
+		forwardedFor = clientIp.String()
+		if clientIp.To4() == nil {
+			forwardedFor = "[" + forwardedFor + "]"
+		}
+	}
+
+	element := "for=" + quoteForwardedValue(forwardedFor)
+	if req.Host != "" {
+		element += ";host=" + quoteForwardedValue(req.Host)
+	}
+	element += ";proto=" + proto
+	appendHeaderList(header, "Forwarded", element)
+}
+
+func appendHeaderList(header http.Header, key string, value string) {
+	if prior := header.Values(key); len(prior) > 0 {
+		value = strings.Join(prior, ", ") + ", " + value
+	}
+	header.Set(key, value)
+}
+
+func remoteIp(remoteAddr string) net.IP {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+func isTrustedProxy(ip net.IP, trustedProxies []*net.IPNet) bool {
+	if ip == nil {
+		return false
+	}
+
+	for _, ipNet := range trustedProxies {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// quoteForwardedValue returns the value as a token when possible, otherwise as a quoted string.
+func quoteForwardedValue(value string) string {
+	isToken := value != ""
+	for _, r := range value {
+		if !isTokenChar(r) {
+			isToken = false
+			break
+		}
+	}
+
+	if isToken {
+		return value
+	}
+
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	return `"` + replacer.Replace(value) + `"`
+}
+
+func isTokenChar(r rune) bool {
+	if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+		return true
+	}
+	return strings.ContainsRune("!#$%&'*+-.^_`|~", r)
+}
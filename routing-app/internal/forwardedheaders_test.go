@@ -0,0 +1,101 @@
+package internal
+
+import (
+	"crypto/tls"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTrustedProxies_ValidEntries_ReturnNetworks(t *testing.T) {
+	trustedProxies, err := ParseTrustedProxies([]string{"10.0.0.1", "192.168.0.0/16", "::1"})
+
+	assert.NoError(t, err)
+	assert.Len(t, trustedProxies, 3)
+	assert.True(t, isTrustedProxy(remoteIp("10.0.0.1:1234"), trustedProxies))
+	assert.True(t, isTrustedProxy(remoteIp("192.168.10.20:1234"), trustedProxies))
+	assert.True(t, isTrustedProxy(remoteIp("[::1]:1234"), trustedProxies))
+	assert.False(t, isTrustedProxy(remoteIp("10.0.0.2:1234"), trustedProxies))
+}
+
+func TestParseTrustedProxies_InvalidEntry_ReturnError(t *testing.T) {
+	_, err := ParseTrustedProxies([]string{"10.0.0.1", "not-an-ip"})
+	assert.Error(t, err)
+
+	_, err = ParseTrustedProxies([]string{"10.0.0.0/40"})
+	assert.Error(t, err)
+}
+
+func TestSetForwardedHeaders_DirectClient_AddForwardingHeaders(t *testing.T) {
+	request, _ := http.NewRequest("POST", "http://router.local:3000/echojson", nil)
+	request.RemoteAddr = "203.0.113.7:50000"
+	header := http.Header{}
+
+	setForwardedHeaders(header, request, nil)
+
+	assert.Equal(t, "203.0.113.7", header.Get("X-Forwarded-For"))
+	assert.Equal(t, "http", header.Get("X-Forwarded-Proto"))
+	assert.Equal(t, "router.local:3000", header.Get("X-Forwarded-Host"))
+	assert.Equal(t, `for=203.0.113.7;host="router.local:3000";proto=http`, header.Get("Forwarded"))
+}
+
+func TestSetForwardedHeaders_UntrustedPeer_OverwriteIncomingHeaders(t *testing.T) {
+	request, _ := http.NewRequest("POST", "http://router.local/echojson", nil)
+	request.RemoteAddr = "203.0.113.7:50000"
+	header := http.Header{}
+	header.Set("X-Forwarded-For", "1.2.3.4")
+	header.Set("X-Forwarded-Proto", "https")
+	header.Set("X-Forwarded-Host", "spoofed.example")
+	header.Set("Forwarded", "for=1.2.3.4")
+
+	trustedProxies, _ := ParseTrustedProxies([]string{"10.0.0.0/8"})
+	setForwardedHeaders(header, request, trustedProxies)
+
+	assert.Equal(t, "203.0.113.7", header.Get("X-Forwarded-For"))
+	assert.Equal(t, "http", header.Get("X-Forwarded-Proto"))
+	assert.Equal(t, "router.local", header.Get("X-Forwarded-Host"))
+	assert.Equal(t, "for=203.0.113.7;host=router.local;proto=http", header.Get("Forwarded"))
+}
+
+func TestSetForwardedHeaders_TrustedPeer_AppendToIncomingHeaders(t *testing.T) {
+	request, _ := http.NewRequest("POST", "http://router.local/echojson", nil)
+	request.RemoteAddr = "10.0.0.5:50000"
+	header := http.Header{}
+	header.Add("X-Forwarded-For", "198.51.100.1")
+	header.Add("X-Forwarded-For", "198.51.100.2")
+	header.Set("X-Forwarded-Proto", "https")
+	header.Set("X-Forwarded-Host", "api.example")
+	header.Set("Forwarded", "for=198.51.100.1;proto=https")
+
+	trustedProxies, _ := ParseTrustedProxies([]string{"10.0.0.0/8"})
+	setForwardedHeaders(header, request, trustedProxies)
+
+	assert.Equal(t, "198.51.100.1, 198.51.100.2, 10.0.0.5", header.Get("X-Forwarded-For"))
+	assert.Equal(t, "https", header.Get("X-Forwarded-Proto"))
+	assert.Equal(t, "api.example", header.Get("X-Forwarded-Host"))
+	assert.Equal(t, "for=198.51.100.1;proto=https, for=10.0.0.5;host=router.local;proto=http", header.Get("Forwarded"))
+}
+
+func TestSetForwardedHeaders_Ipv6ClientOverTls_QuoteForwardedValue(t *testing.T) {
+	request, _ := http.NewRequest("POST", "https://router.local/echojson", nil)
+	request.RemoteAddr = "[2001:db8::1]:50000"
+	request.TLS = &tls.ConnectionState{}
+	header := http.Header{}
+
+	setForwardedHeaders(header, request, nil)
+
+	assert.Equal(t, "2001:db8::1", header.Get("X-Forwarded-For"))
+	assert.Equal(t, "https", header.Get("X-Forwarded-Proto"))
+	assert.Equal(t, `for="[2001:db8::1]";host=router.local;proto=https`, header.Get("Forwarded"))
+}
+
+func TestSetForwardedHeaders_UnknownRemoteAddr_UseUnknownNode(t *testing.T) {
+	request, _ := http.NewRequest("POST", "/echojson", nil)
+	header := http.Header{}
+
+	setForwardedHeaders(header, request, nil)
+
+	assert.Empty(t, header.Get("X-Forwarded-For"))
+	assert.Equal(t, "for=unknown;proto=http", header.Get("Forwarded"))
+}
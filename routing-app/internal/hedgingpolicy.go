@@ -0,0 +1,119 @@
+package internal
+
+import (
+	"andrewsaputra/routing-app/api"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultHedgingPercentile     = 95
+	defaultHedgingMaxDelayMillis = 1000
+	hedgingLatencySamples        = 1000
+	hedgingMinLatencySamples     = 20
+)
+
+func constructHedgingPolicy(configs []api.HedgedRouteConfig) *hedgingPolicy {
+	routes := make([]*hedgedRoute, 0, len(configs))
+	for _, config := range configs {
+		percentile := config.DelayPercentile
+		if percentile <= 0 || percentile > 100 {
+			percentile = defaultHedgingPercentile
+		}
+
+		minDelay := time.Duration(config.MinDelayMillis) * time.Millisecond
+		if minDelay < 0 {
+			minDelay = 0
+		}
+
+		maxDelay := time.Duration(config.MaxDelayMillis) * time.Millisecond
+		if maxDelay <= 0 {
+			maxDelay = defaultHedgingMaxDelayMillis * time.Millisecond
+		}
+		if maxDelay < minDelay {
+			maxDelay = minDelay
+		}
+
+		routes = append(routes, &hedgedRoute{
+			pathPrefix: config.PathPrefix,
+			percentile: percentile,
+			minDelay:   minDelay,
+			maxDelay:   maxDelay,
+			samples:    make([]time.Duration, 0, hedgingLatencySamples),
+		})
+	}
+
+	return &hedgingPolicy{
+		routes: routes,
+	}
+}
+
+// hedgingPolicy holds the routes for which a second copy of a request is sent to another host when the
+// first one is slower than usual.
+type hedgingPolicy struct {
+	routes []*hedgedRoute
+}
+
+// hedgedRoute keeps the latencies recently observed on a route. A request is hedged once it has been
+// waiting longer than the configured percentile of those latencies, clamped to [minDelay, maxDelay].
+type hedgedRoute struct {
+	pathPrefix string
+	percentile int
+	minDelay   time.Duration
+	maxDelay   time.Duration
+	samples    []time.Duration
+	next       int
+	lock       sync.Mutex
+}
+
+// match returns the route with the longest prefix of path, or nil when the path isn't hedged.
+func (this *hedgingPolicy) match(path string) *hedgedRoute {
+	var result *hedgedRoute
+	for _, route := range this.routes {
+		if strings.HasPrefix(path, route.pathPrefix) && (result == nil || len(route.pathPrefix) > len(result.pathPrefix)) {
+			result = route
+		}
+	}
+	return result
+}
+
+// delay returns the wait before hedging a request. Until enough latencies have been observed the max
+// delay is used, so a cold route doesn't double its traffic.
+func (this *hedgedRoute) delay() time.Duration {
+	this.lock.Lock()
+	if len(this.samples) < hedgingMinLatencySamples {
+		this.lock.Unlock()
+		return this.maxDelay
+	}
+	samples := append([]time.Duration{}, this.samples...)
+	this.lock.Unlock()
+
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i] < samples[j]
+	})
+
+	index := (len(samples)*this.percentile+99)/100 - 1
+	delay := samples[index]
+	if delay < this.minDelay {
+		return this.minDelay
+	}
+	if delay > this.maxDelay {
+		return this.maxDelay
+	}
+	return delay
+}
+
+func (this *hedgedRoute) recordLatency(latency time.Duration) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if len(this.samples) < hedgingLatencySamples {
+		this.samples = append(this.samples, latency)
+		return
+	}
+
+	this.samples[this.next] = latency
+	this.next = (this.next + 1) % hedgingLatencySamples
+}
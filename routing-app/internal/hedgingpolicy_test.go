@@ -0,0 +1,148 @@
+package internal
+
+import (
+	"andrewsaputra/routing-app/api"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHedgingPolicyMatch_OverlappingPrefixes_ReturnLongestPrefix(t *testing.T) {
+	policy := constructHedgingPolicy([]api.HedgedRouteConfig{
+		{PathPrefix: "/api"},
+		{PathPrefix: "/api/search"},
+	})
+
+	assert.Equal(t, "/api/search", policy.match("/api/search/items").pathPrefix)
+	assert.Equal(t, "/api", policy.match("/api/orders").pathPrefix)
+	assert.Nil(t, policy.match("/status"))
+}
+
+func TestHedgedRouteDelay_NotEnoughSamples_ReturnMaxDelay(t *testing.T) {
+	route := constructHedgingPolicy([]api.HedgedRouteConfig{{PathPrefix: "/", MaxDelayMillis: 300}}).routes[0]
+	route.recordLatency(time.Millisecond)
+
+	assert.Equal(t, 300*time.Millisecond, route.delay())
+}
+
+func TestHedgedRouteDelay_EnoughSamples_ReturnClampedPercentile(t *testing.T) {
+	route := constructHedgingPolicy([]api.HedgedRouteConfig{
+		{PathPrefix: "/", DelayPercentile: 90, MinDelayMillis: 5, MaxDelayMillis: 1000},
+	}).routes[0]
+
+	for i := 1; i <= 100; i++ {
+		route.recordLatency(time.Duration(i) * time.Millisecond)
+	}
+	assert.Equal(t, 90*time.Millisecond, route.delay())
+
+	fastRoute := constructHedgingPolicy([]api.HedgedRouteConfig{
+		{PathPrefix: "/", MinDelayMillis: 5, MaxDelayMillis: 1000},
+	}).routes[0]
+	for i := 0; i < 100; i++ {
+		fastRoute.recordLatency(time.Millisecond)
+	}
+	assert.Equal(t, 5*time.Millisecond, fastRoute.delay())
+}
+
+func TestForwardRequest_SlowHost_HedgedToOtherHost(t *testing.T) {
+	roundTripper := &DelayingRoundTripper{delays: map[string]time.Duration{"host1": 5 * time.Second}}
+	router, hostManager := Helper_ConstructHedgingRouter(roundTripper)
+	hostManager.RegisterHost("http://host1")
+	hostManager.RegisterHost("http://host2")
+
+	request, _ := http.NewRequest("GET", "/search", nil)
+	startedAt := time.Now()
+	resp, err := router.ForwardRequest(request)
+
+	assert.NoError(t, err)
+	assert.Less(t, time.Since(startedAt), time.Second)
+	assert.Equal(t, "http://host1, http://host2", resp.Header.Get(routingAttemptsHeader))
+	resp.Body.Close()
+
+	assert.Eventually(t, func() bool {
+		return roundTripper.getCancelled() == 1
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestForwardRequest_FastHost_NotHedged(t *testing.T) {
+	roundTripper := &DelayingRoundTripper{delays: map[string]time.Duration{}}
+	router, hostManager := Helper_ConstructHedgingRouter(roundTripper)
+	hostManager.RegisterHost("http://host1")
+	hostManager.RegisterHost("http://host2")
+
+	request, _ := http.NewRequest("GET", "/search", nil)
+	resp, err := router.ForwardRequest(request)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "http://host1", resp.Header.Get(routingAttemptsHeader))
+	assert.Equal(t, 1, roundTripper.getCalls())
+}
+
+func TestForwardRequest_NonIdempotentRequest_NotHedged(t *testing.T) {
+	roundTripper := &DelayingRoundTripper{delays: map[string]time.Duration{"host1": 200 * time.Millisecond}}
+	router, hostManager := Helper_ConstructHedgingRouter(roundTripper)
+	hostManager.RegisterHost("http://host1")
+	hostManager.RegisterHost("http://host2")
+
+	request, _ := http.NewRequest("POST", "/search", nil)
+	resp, err := router.ForwardRequest(request)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "http://host1", resp.Header.Get(routingAttemptsHeader))
+	assert.Equal(t, 1, roundTripper.getCalls())
+}
+
+func Helper_ConstructHedgingRouter(roundTripper http.RoundTripper) (*RoundRobinRouter, *HostManager) {
+	client := &http.Client{
+		Transport: roundTripper,
+	}
+
+	hostManager := Helper_ConstructHostManager()
+	router := ConstructRoundRobinRouter(client, hostManager, api.RequestHandlingConfig{
+		HedgedRoutes: []api.HedgedRouteConfig{{PathPrefix: "/search", MaxDelayMillis: 50}},
+	})
+	return router, hostManager
+}
+
+// DelayingRoundTripper answers after the delay configured for the target host, unless the request gets
+// cancelled first.
+type DelayingRoundTripper struct {
+	delays    map[string]time.Duration
+	calls     int
+	cancelled int
+	lock      sync.Mutex
+}
+
+func (this *DelayingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	this.lock.Lock()
+	this.calls++
+	delay := this.delays[req.URL.Host]
+	this.lock.Unlock()
+
+	select {
+	case <-time.After(delay):
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	case <-req.Context().Done():
+		this.lock.Lock()
+		this.cancelled++
+		this.lock.Unlock()
+		return nil, req.Context().Err()
+	}
+}
+
+func (this *DelayingRoundTripper) getCalls() int {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	return this.calls
+}
+
+func (this *DelayingRoundTripper) getCancelled() int {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	return this.cancelled
+}
@@ -3,6 +3,8 @@ package internal
 import (
 	"andrewsaputra/routing-app/api"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/stretchr/testify/mock"
 )
@@ -20,7 +22,7 @@ func (this *MockRoundTripper) RoundTrip(req *http.Request) (*http.Response, erro
 func Helper_ConstructMockHttpClient() *http.Client {
 	roundTripper := new(MockRoundTripper)
 	roundTripper.On("RoundTrip", mock.Anything).
-		Return(&http.Response{StatusCode: http.StatusOK}, nil)
+		Return(&http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil)
 
 	client := &http.Client{
 		Transport: roundTripper,
@@ -41,12 +43,106 @@ func Helper_ConstructHealthCheckConfig() api.HealthCheckConfig {
 func Helper_ConstructHostManager() *HostManager {
 	config := Helper_ConstructHealthCheckConfig()
 	client := Helper_ConstructMockHttpClient()
-	return ConstructHostManager(client, config)
+	mgr, _ := ConstructHostManager(client, config, api.HostLeaseConfig{}, nil)
+	return mgr
+}
+
+// FakeClock is a settable clock, safe to read from the goroutines started by the HostManager.
+type FakeClock struct {
+	now  time.Time
+	lock sync.Mutex
+}
+
+func (this *FakeClock) Now() time.Time {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return this.now
+}
+
+func (this *FakeClock) Advance(duration time.Duration) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.now = this.now.Add(duration)
+}
+
+// Helper_SetFakeClock replaces the clock used for leases. The clock is only read while holding
+// updateLock.
+func Helper_SetFakeClock(mgr *HostManager) *FakeClock {
+	clock := &FakeClock{now: time.Now()}
+	mgr.updateLock.Lock()
+	defer mgr.updateLock.Unlock()
+	mgr.now = clock.Now
+	return clock
+}
+
+// Helper_SetHostHealthy changes the health flag while holding the manager lock, keeping tests race free.
+func Helper_SetHostHealthy(mgr *HostManager, hostAddress string, healthy bool) {
+	mgr.lock.Lock()
+	defer mgr.lock.Unlock()
+
+	for _, host := range mgr.hosts {
+		if host.Address == hostAddress {
+			host.Healthy = healthy
+		}
+	}
+}
+
+func Helper_GetHosts(mgr *HostManager) []api.Host {
+	mgr.lock.RLock()
+	defer mgr.lock.RUnlock()
+
+	hosts := []api.Host{}
+	for _, host := range mgr.hosts {
+		hosts = append(hosts, host.snapshot())
+	}
+	return hosts
 }
 
 func Helper_ConstructRoundRobinRouter() (*RoundRobinRouter, *HostManager) {
 	client := Helper_ConstructMockHttpClient()
 	hostManager := Helper_ConstructHostManager()
-	router := ConstructRoundRobinRouter(client, hostManager, 0)
+	router := ConstructRoundRobinRouter(client, hostManager, api.RequestHandlingConfig{MaxRetries: 0})
+	return router, hostManager
+}
+
+func Helper_ConstructWeightedRoundRobinRouter() (*WeightedRoundRobinRouter, *HostManager) {
+	client := Helper_ConstructMockHttpClient()
+	hostManager := Helper_ConstructHostManager()
+	router := ConstructWeightedRoundRobinRouter(client, hostManager, api.RequestHandlingConfig{MaxRetries: 0})
+	return router, hostManager
+}
+
+func Helper_ConstructLeastConnectionsRouter() (*LeastConnectionsRouter, *HostManager) {
+	client := Helper_ConstructMockHttpClient()
+	hostManager := Helper_ConstructHostManager()
+	router := ConstructLeastConnectionsRouter(client, hostManager, api.RequestHandlingConfig{MaxRetries: 0})
+	return router, hostManager
+}
+
+func Helper_ConstructPowerOfTwoChoicesRouter() (*PowerOfTwoChoicesRouter, *HostManager) {
+	client := Helper_ConstructMockHttpClient()
+	hostManager := Helper_ConstructHostManager()
+	router := ConstructPowerOfTwoChoicesRouter(client, hostManager, api.RequestHandlingConfig{MaxRetries: 0})
+	return router, hostManager
+}
+
+func Helper_ConstructConsistentHashRouter(keySource string, keyName string) (*ConsistentHashRouter, *HostManager) {
+	client := Helper_ConstructMockHttpClient()
+	hostManager := Helper_ConstructHostManager()
+	router, _ := ConstructConsistentHashRouter(client, hostManager, api.RequestHandlingConfig{MaxRetries: 0}, api.ConsistentHashConfig{
+		KeySource: keySource,
+		KeyName:   keyName,
+	})
+	return router, hostManager
+}
+
+func Helper_ConstructLatencyAwareRouter(explorationPercent int) (*LatencyAwareRouter, *HostManager) {
+	client := Helper_ConstructMockHttpClient()
+	hostManager := Helper_ConstructHostManager()
+	router := ConstructLatencyAwareRouter(client, hostManager, api.RequestHandlingConfig{MaxRetries: 0}, api.LatencyAwareConfig{
+		SmoothingFactor:      0.5,
+		ExplorationPercent:   explorationPercent,
+		FailurePenaltyMillis: 1000,
+	})
 	return router, hostManager
 }
@@ -0,0 +1,298 @@
+package internal
+
+import (
+	"andrewsaputra/routing-app/api"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"sync"
+)
+
+const hostLogCompactionRecords = 1000
+
+func ConstructLogFileHostStore(path string) (*LogFileHostStore, error) {
+	return &LogFileHostStore{
+		path: path,
+	}, nil
+}
+
+// LogFileHostStore is an embedded append only store : every change to the pool is appended to the log as
+// a single checksummed record holding the hosts added, updated or removed, and synced before Save returns.
+// A record torn by a crash fails its checksum and is discarded on the next load, along with anything
+// after it. The log is compacted into a single record once it grows large or when the pool is reordered.
+type LogFileHostStore struct {
+	path            string
+	file            *os.File
+	hosts           []api.HostSpec
+	numRecords      int
+	needsCompaction bool
+	loaded          bool
+	lock            sync.Mutex
+}
+
+// hostLogRecord is a single change to the pool. Hosts are identified by ID.
+type hostLogRecord struct {
+	Put    []api.HostSpec `json:"put,omitempty"`
+	Delete []string       `json:"delete,omitempty"`
+}
+
+func (this *LogFileHostStore) Load() ([]api.HostSpec, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	err := this.load()
+	if err != nil {
+		return nil, err
+	}
+	return append([]api.HostSpec{}, this.hosts...), nil
+}
+
+func (this *LogFileHostStore) Save(hosts []api.HostSpec) error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if !this.loaded {
+		err := this.load()
+		if err != nil {
+			return err
+		}
+	}
+
+	record := diffHostLog(this.hosts, hosts)
+	if len(record.Put) == 0 && len(record.Delete) == 0 && sameHostOrder(this.hosts, hosts) {
+		return nil
+	}
+
+	if this.needsCompaction || this.numRecords >= hostLogCompactionRecords || !sameHostOrder(applyHostLog(this.hosts, record), hosts) {
+		return this.compact(hosts)
+	}
+
+	line, err := encodeHostLogRecord(record)
+	if err != nil {
+		return err
+	}
+
+	_, err = this.file.Write(line)
+	if err == nil {
+		err = this.file.Sync()
+	}
+	if err != nil {
+		// the log may now end with a torn record, rewrite it as a whole on the next save
+		this.needsCompaction = true
+		return err
+	}
+
+	this.numRecords++
+	this.hosts = append([]api.HostSpec{}, hosts...)
+	return nil
+}
+
+func (this *LogFileHostStore) Close() error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if this.file == nil {
+		return nil
+	}
+
+	err := this.file.Close()
+	this.file = nil
+	this.loaded = false
+	return err
+}
+
+// Private Functions
+
+// load replays the log, truncating a torn tail left by a crash, and opens the log for appending.
+func (this *LogFileHostStore) load() error {
+	raw, err := os.ReadFile(this.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	hosts := []api.HostSpec{}
+	numRecords := 0
+	offset := 0
+	for offset < len(raw) {
+		end := bytes.IndexByte(raw[offset:], '\n')
+		if end < 0 {
+			break
+		}
+
+		record, err := decodeHostLogRecord(raw[offset : offset+end])
+		if err != nil {
+			break
+		}
+
+		hosts = applyHostLog(hosts, record)
+		numRecords++
+		offset += end + 1
+	}
+
+	if offset < len(raw) {
+		fmt.Println("discarding", len(raw)-offset, "bytes of torn records from", this.path)
+		err = os.Truncate(this.path, int64(offset))
+		if err != nil {
+			return err
+		}
+	}
+
+	err = os.MkdirAll(filepath.Dir(this.path), 0o755)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(this.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+
+	if this.file != nil {
+		this.file.Close()
+	}
+	this.file = file
+	this.hosts = hosts
+	this.numRecords = numRecords
+	this.loaded = true
+	return nil
+}
+
+// compact atomically replaces the log with a single record holding the whole pool.
+func (this *LogFileHostStore) compact(hosts []api.HostSpec) error {
+	line, err := encodeHostLogRecord(hostLogRecord{Put: hosts})
+	if err != nil {
+		return err
+	}
+
+	err = writeFileAtomic(this.path, line)
+	if err != nil {
+		return err
+	}
+
+	// the previous file handle points to the replaced log
+	file, err := os.OpenFile(this.path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		this.loaded = false
+		return err
+	}
+
+	this.file.Close()
+	this.file = file
+	this.hosts = append([]api.HostSpec{}, hosts...)
+	this.numRecords = 1
+	this.needsCompaction = false
+	return nil
+}
+
+// encodeHostLogRecord formats a record as a line made of its crc32 checksum followed by its json form.
+func encodeHostLogRecord(record hostLogRecord) ([]byte, error) {
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+
+	line := fmt.Sprintf("%08x %s\n", crc32.ChecksumIEEE(payload), payload)
+	return []byte(line), nil
+}
+
+func decodeHostLogRecord(line []byte) (hostLogRecord, error) {
+	var record hostLogRecord
+	if len(line) < 9 || line[8] != ' ' {
+		return record, errors.New("malformed host log record")
+	}
+
+	checksum, err := strconv.ParseUint(string(line[:8]), 16, 32)
+	if err != nil {
+		return record, err
+	}
+
+	payload := line[9:]
+	if crc32.ChecksumIEEE(payload) != uint32(checksum) {
+		return record, errors.New("host log record checksum mismatch")
+	}
+
+	err = json.Unmarshal(payload, &record)
+	return record, err
+}
+
+// diffHostLog returns the record turning the current pool into the next one.
+func diffHostLog(current []api.HostSpec, next []api.HostSpec) hostLogRecord {
+	record := hostLogRecord{}
+	currentById := map[string]api.HostSpec{}
+	for _, host := range current {
+		currentById[host.ID] = host
+	}
+
+	nextIds := map[string]bool{}
+	for _, host := range next {
+		nextIds[host.ID] = true
+		previous, ok := currentById[host.ID]
+		if !ok || !reflect.DeepEqual(normalizeStoredHost(previous), normalizeStoredHost(host)) {
+			record.Put = append(record.Put, host)
+		}
+	}
+
+	for _, host := range current {
+		if !nextIds[host.ID] {
+			record.Delete = append(record.Delete, host.ID)
+		}
+	}
+	return record
+}
+
+// applyHostLog returns the pool with the record applied. Updated hosts keep their position and new
+// hosts are appended.
+func applyHostLog(hosts []api.HostSpec, record hostLogRecord) []api.HostSpec {
+	deleted := map[string]bool{}
+	for _, id := range record.Delete {
+		deleted[id] = true
+	}
+
+	result := make([]api.HostSpec, 0, len(hosts)+len(record.Put))
+	for _, host := range hosts {
+		if !deleted[host.ID] {
+			result = append(result, host)
+		}
+	}
+
+	for _, host := range record.Put {
+		updated := false
+		for i := range result {
+			if result[i].ID == host.ID {
+				result[i] = host
+				updated = true
+				break
+			}
+		}
+
+		if !updated {
+			result = append(result, host)
+		}
+	}
+	return result
+}
+
+func sameHostOrder(hosts []api.HostSpec, other []api.HostSpec) bool {
+	if len(hosts) != len(other) {
+		return false
+	}
+
+	for i := range hosts {
+		if hosts[i].ID != other[i].ID {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeStoredHost treats nil and empty metadata alike, as they're stored the same way.
+func normalizeStoredHost(host api.HostSpec) api.HostSpec {
+	host.Metadata = copyMetadata(host.Metadata)
+	return host
+}
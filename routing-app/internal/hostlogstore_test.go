@@ -0,0 +1,108 @@
+package internal
+
+import (
+	"andrewsaputra/routing-app/api"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogFileHostStore_SaveThenLoad_RoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts.log")
+	store, _ := ConstructLogFileHostStore(path)
+	defer store.Close()
+
+	host1 := api.HostSpec{ID: "host-1", Address: "http://localhost:4001", Weight: 1, Metadata: map[string]string{}}
+	host2 := api.HostSpec{ID: "host-2", Address: "http://localhost:4002", Weight: 1, Metadata: map[string]string{"zone": "a"}}
+	host3 := api.HostSpec{ID: "host-3", Address: "http://localhost:4003", Weight: 1, Metadata: map[string]string{}}
+	updated := host2
+	updated.Weight = 4
+
+	assert.NoError(t, store.Save([]api.HostSpec{host1}))
+	assert.NoError(t, store.Save([]api.HostSpec{host1, host2}))
+	assert.NoError(t, store.Save([]api.HostSpec{host1, updated, host3}))
+	assert.NoError(t, store.Save([]api.HostSpec{updated, host3}))
+
+	reopened, _ := ConstructLogFileHostStore(path)
+	defer reopened.Close()
+	hosts, err := reopened.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, []api.HostSpec{updated, host3}, hosts)
+
+	// each save appended a single record
+	raw, _ := os.ReadFile(path)
+	assert.Equal(t, 4, strings.Count(string(raw), "\n"))
+}
+
+func TestLogFileHostStore_TornRecord_DiscardedOnLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts.log")
+	store, _ := ConstructLogFileHostStore(path)
+	host1 := api.HostSpec{ID: "host-1", Address: "http://localhost:4001", Weight: 1, Metadata: map[string]string{}}
+	host2 := api.HostSpec{ID: "host-2", Address: "http://localhost:4002", Weight: 1, Metadata: map[string]string{}}
+	store.Save([]api.HostSpec{host1})
+	store.Save([]api.HostSpec{host1, host2})
+	store.Close()
+
+	// simulate a crash in the middle of the last append
+	raw, _ := os.ReadFile(path)
+	os.WriteFile(path, raw[:len(raw)-10], 0o644)
+
+	reopened, _ := ConstructLogFileHostStore(path)
+	defer reopened.Close()
+	hosts, err := reopened.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, []api.HostSpec{host1}, hosts)
+
+	// new records are appended after the last valid one
+	host3 := api.HostSpec{ID: "host-3", Address: "http://localhost:4003", Weight: 1, Metadata: map[string]string{}}
+	assert.NoError(t, reopened.Save([]api.HostSpec{host1, host3}))
+
+	final, _ := ConstructLogFileHostStore(path)
+	defer final.Close()
+	hosts, _ = final.Load()
+	assert.Equal(t, []api.HostSpec{host1, host3}, hosts)
+}
+
+func TestLogFileHostStore_CorruptedRecord_DiscardedOnLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts.log")
+	store, _ := ConstructLogFileHostStore(path)
+	host1 := api.HostSpec{ID: "host-1", Address: "http://localhost:4001", Weight: 1, Metadata: map[string]string{}}
+	host2 := api.HostSpec{ID: "host-2", Address: "http://localhost:4002", Weight: 1, Metadata: map[string]string{}}
+	store.Save([]api.HostSpec{host1})
+	store.Save([]api.HostSpec{host1, host2})
+	store.Close()
+
+	raw, _ := os.ReadFile(path)
+	os.WriteFile(path, []byte(strings.Replace(string(raw), "4002", "4009", 1)), 0o644)
+
+	reopened, _ := ConstructLogFileHostStore(path)
+	defer reopened.Close()
+	hosts, err := reopened.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, []api.HostSpec{host1}, hosts)
+}
+
+func TestLogFileHostStore_Reordered_CompactLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts.log")
+	store, _ := ConstructLogFileHostStore(path)
+	defer store.Close()
+	host1 := api.HostSpec{ID: "host-1", Address: "http://localhost:4001", Weight: 1, Metadata: map[string]string{}}
+	host2 := api.HostSpec{ID: "host-2", Address: "http://localhost:4002", Weight: 1, Metadata: map[string]string{}}
+	store.Save([]api.HostSpec{host1})
+	store.Save([]api.HostSpec{host1, host2})
+	store.Save([]api.HostSpec{host2, host1})
+
+	raw, _ := os.ReadFile(path)
+	assert.Equal(t, 1, strings.Count(string(raw), "\n"))
+
+	// appends keep working on the compacted log
+	store.Save([]api.HostSpec{host2})
+
+	reopened, _ := ConstructLogFileHostStore(path)
+	defer reopened.Close()
+	hosts, _ := reopened.Load()
+	assert.Equal(t, []api.HostSpec{host2}, hosts)
+}
@@ -2,131 +2,1024 @@ package internal
 
 import (
 	"andrewsaputra/routing-app/api"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"net/http"
+	"reflect"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
-func ConstructHostManager(client *http.Client, healthCheckConfig api.HealthCheckConfig) *HostManager {
+const (
+	NoHealthyHostFailOpen       = "FailOpen"
+	NoHealthyHostFailClosed     = "FailClosed"
+	NoHealthyHostPanicThreshold = "PanicThreshold"
+
+	defaultHostWeight            = 1
+	defaultPanicThresholdPercent = 50
+	defaultLeaseSweepSeconds     = 1
+)
+
+// Sources a host can be registered from. Hosts registered through the api may be changed by any
+// operation, while the hosts of the other origins are reconciled by SyncHosts.
+const (
+	HostOriginApi    = "api"
+	HostOriginConfig = "config"
+	HostOriginFile   = "file"
+	HostOriginDns    = "dns"
+)
+
+// hosts declared in the config, the hosts file or dns are reconciled from their source and can't lapse
+var errDeclaredHostLease = errors.New("Only hosts registered through the api can hold a lease")
+
+// ValidateHealthCheckConfig rejects health check settings the HostManager can't apply.
+func ValidateHealthCheckConfig(config api.HealthCheckConfig) error {
+	switch config.NoHealthyHostPolicy {
+	case "", NoHealthyHostFailOpen, NoHealthyHostFailClosed, NoHealthyHostPanicThreshold:
+	default:
+		return fmt.Errorf("unsupported no healthy host policy %q", config.NoHealthyHostPolicy)
+	}
+
+	if config.PanicThresholdPercent < 0 || config.PanicThresholdPercent > 100 {
+		return fmt.Errorf("panic threshold percent must be between 0 and 100")
+	}
+	return nil
+}
+
+// ValidateHostLeaseConfig rejects lease settings the HostManager can't apply.
+func ValidateHostLeaseConfig(config api.HostLeaseConfig) error {
+	if config.DefaultTtlSeconds < 0 || config.MaxTtlSeconds < 0 || config.SweepIntervalSeconds < 0 {
+		return fmt.Errorf("host lease settings must not be negative")
+	}
+
+	if config.MaxTtlSeconds > 0 && config.DefaultTtlSeconds > config.MaxTtlSeconds {
+		return fmt.Errorf("default lease ttl must not exceed the max lease ttl")
+	}
+	return nil
+}
+
+// ConstructHostManager restores the hosts saved in store, which may be nil when hosts aren't persisted.
+func ConstructHostManager(client *http.Client, healthCheckConfig api.HealthCheckConfig, leaseConfig api.HostLeaseConfig, store HostStore) (*HostManager, error) {
+	noHealthyHostPolicy := healthCheckConfig.NoHealthyHostPolicy
+	if noHealthyHostPolicy == "" {
+		noHealthyHostPolicy = NoHealthyHostFailOpen
+	}
+
+	panicThresholdPercent := healthCheckConfig.PanicThresholdPercent
+	if panicThresholdPercent <= 0 {
+		panicThresholdPercent = defaultPanicThresholdPercent
+	}
+
+	leaseSweepSeconds := leaseConfig.SweepIntervalSeconds
+	if leaseSweepSeconds <= 0 {
+		leaseSweepSeconds = defaultLeaseSweepSeconds
+	}
+
 	manager := &HostManager{
-		hosts:         []api.Host{},
-		client:        client,
-		numRequiredHC: healthCheckConfig.NumRequired,
-		hcPath:        healthCheckConfig.Path,
+		hosts:                  []*hostEntry{},
+		hostsByAddress:         map[string]*hostEntry{},
+		client:                 client,
+		numRequiredHC:          healthCheckConfig.NumRequired,
+		hcPath:                 healthCheckConfig.Path,
+		hcInterval:             time.Duration(healthCheckConfig.IntervalSeconds) * time.Second,
+		outlierDetector:        constructOutlierDetector(healthCheckConfig.OutlierDetection),
+		noHealthyHostPolicy:    noHealthyHostPolicy,
+		panicThresholdPercent:  panicThresholdPercent,
+		defaultLeaseTtlSeconds: leaseConfig.DefaultTtlSeconds,
+		maxLeaseTtlSeconds:     leaseConfig.MaxTtlSeconds,
+		store:                  store,
+		now:                    time.Now,
 	}
 
-	hcInterval := time.Duration(healthCheckConfig.IntervalSeconds) * time.Second
-	go manager.scheduleHealthChecks(hcInterval)
+	if store != nil {
+		stored, err := store.Load()
+		if err != nil {
+			return nil, fmt.Errorf("failed loading hosts : %w", err)
+		}
 
-	return manager
+		specs := []api.HostSpec{}
+		for _, spec := range stored {
+			// hosts saved before origins were tracked were registered through the api, while declared
+			// hosts saved by earlier versions are left to their source
+			if spec.Origin == "" {
+				spec.Origin = HostOriginApi
+			}
+			if spec.Origin == HostOriginApi {
+				specs = append(specs, spec)
+			}
+		}
+
+		specs, err = normalizeHostSpecs(specs)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stored hosts : %w", err)
+		}
+
+		for _, spec := range specs {
+			// leases start over, giving leased hosts a full ttl to send their next heartbeat
+			manager.hosts = append(manager.hosts, manager.newHost(spec))
+		}
+	}
+	manager.indexHosts(manager.hosts)
+
+	go manager.scheduleHealthChecks(manager.hcInterval)
+	go manager.scheduleLeaseSweeps(time.Duration(leaseSweepSeconds) * time.Second)
+
+	return manager, nil
 }
 
 type HostManager struct {
-	hosts         []api.Host
-	client        *http.Client
-	numRequiredHC int
-	hcPath        string
-	lock          sync.RWMutex
+	hosts                  []*hostEntry
+	hostsByAddress         map[string]*hostEntry
+	client                 *http.Client
+	numRequiredHC          int
+	hcPath                 string
+	hcInterval             time.Duration
+	outlierDetector        *outlierDetector
+	noHealthyHostPolicy    string
+	panicThresholdPercent  int
+	defaultLeaseTtlSeconds int
+	maxLeaseTtlSeconds     int
+	store                  HostStore
+	lock                   sync.RWMutex
+
+	// now times leases and is only called while holding updateLock.
+	now func() time.Time
+
+	// updateLock serializes changes to the pool, so the store can be written without holding lock and
+	// blocking request routing. The ID, Address, Weight, Metadata and lease of hosts, along with the
+	// hosts slice and its index, only change while holding both locks and may be read while holding either.
+	updateLock sync.Mutex
+
+	// numHosts and numEjected let trackAttempt enforce maxEjectionPercent without going through lock.
+	// numEjected counts the registered hosts whose circuit isn't closed.
+	numHosts   atomic.Int32
+	numEjected atomic.Int32
+}
+
+// hostEntry is the state kept for a single registered host. Entries are only ever referenced by
+// pointer, so a health check started before a deregistration can never write into another host.
+// The embedded Host must be accessed while holding HostManager.lock, see updateLock for the exceptions.
+// The breaker and forwarding counters change on every forwarded request, so they're guarded by
+// stateLock instead. removed is only set while holding both HostManager.lock and stateLock.
+type hostEntry struct {
+	api.Host
+	removed    bool
+	stateLock  sync.Mutex
+	breaker    circuitBreaker
+	forwarding api.ForwardingStats
 }
 
 func (this *HostManager) RegisterHost(hostAddress string) api.HandlerResponse {
+	return this.RegisterWeightedHost(hostAddress, defaultHostWeight)
+}
+
+func (this *HostManager) RegisterWeightedHost(hostAddress string, weight int) api.HandlerResponse {
+	if weight < 1 {
+		return api.HandlerResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Host weight must be a positive number",
+		}
+	}
+
+	this.updateLock.Lock()
+	defer this.updateLock.Unlock()
+
+	if this.findHost(hostAddress) != nil {
+		return api.HandlerResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Duplicate host address detected",
+		}
+	}
+
+	host := this.newHost(api.HostSpec{Address: hostAddress, Weight: weight, Origin: HostOriginApi})
+	return this.commitHosts(append(this.copyHosts(), host), nil, api.HandlerResponse{
+		Code:    http.StatusOK,
+		Message: "Successful registration",
+	})
+}
+
+// RegisterLeasedHost registers a host which stays registered as long as its lease is renewed within
+// ttlSeconds. Registering a host which already holds a lease renews it, so a restarted host can register
+// again before its previous lease lapsed.
+func (this *HostManager) RegisterLeasedHost(hostAddress string, weight int, ttlSeconds int) api.HandlerResponse {
+	if weight < 1 {
+		return api.HandlerResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Host weight must be a positive number",
+		}
+	}
+
+	if ttlSeconds < 1 {
+		return api.HandlerResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Lease ttl must be a positive number",
+		}
+	}
+
+	if err := this.validateLeaseTtl(ttlSeconds); err != nil {
+		return api.HandlerResponse{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+
+	this.updateLock.Lock()
+	defer this.updateLock.Unlock()
+
+	host := this.findHost(hostAddress)
+	if host == nil {
+		host = this.newHost(api.HostSpec{Address: hostAddress, Weight: weight, TtlSeconds: ttlSeconds, Origin: HostOriginApi})
+		return this.commitHosts(append(this.copyHosts(), host), nil, api.HandlerResponse{
+			Code:    http.StatusOK,
+			Message: "Successful registration",
+		})
+	}
+
+	if host.LeaseTtlSeconds == 0 {
+		return api.HandlerResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Duplicate host address detected",
+		}
+	}
+
+	spec := host.spec()
+	spec.Weight = weight
+	spec.TtlSeconds = ttlSeconds
+	return this.commitHosts(this.copyHosts(), map[*hostEntry]api.HostSpec{host: spec}, api.HandlerResponse{
+		Code:    http.StatusOK,
+		Message: "Successful lease renewal",
+	})
+}
+
+// RenewLease extends the lease of a host by its ttl.
+func (this *HostManager) RenewLease(hostAddress string) api.HandlerResponse {
+	// holding updateLock keeps the sweeper from removing the host while it's renewed
+	this.updateLock.Lock()
+	defer this.updateLock.Unlock()
+
+	host := this.findHost(hostAddress)
+	if host == nil {
+		return api.HandlerResponse{
+			Code:    http.StatusNotFound,
+			Message: "Host address not found",
+		}
+	}
+
 	this.lock.Lock()
 	defer this.lock.Unlock()
 
-	for _, host := range this.hosts {
-		if host.Address == hostAddress {
+	if host.LeaseTtlSeconds == 0 {
+		return api.HandlerResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Host has no lease",
+		}
+	}
+
+	host.renewLease(host.LeaseTtlSeconds, this.now())
+	return api.HandlerResponse{
+		Code:    http.StatusOK,
+		Message: "Successful lease renewal",
+	}
+}
+
+func (this *HostManager) DeregisterHost(hostAddress string) api.HandlerResponse {
+	this.updateLock.Lock()
+	defer this.updateLock.Unlock()
+
+	host := this.findHost(hostAddress)
+	if host == nil {
+		return api.HandlerResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Host address not found",
+		}
+	}
+
+	return this.commitHosts(this.hostsExcept(map[*hostEntry]bool{host: true}), nil, api.HandlerResponse{
+		Code:    http.StatusOK,
+		Message: "Successful deregistration",
+	})
+}
+
+// RemoveHost deregisters the host referenced by ID or address.
+func (this *HostManager) RemoveHost(ref string) api.HandlerResponse {
+	this.updateLock.Lock()
+	defer this.updateLock.Unlock()
+
+	host := this.findHostByRef(ref)
+	if host == nil {
+		return api.HandlerResponse{
+			Code:    http.StatusNotFound,
+			Message: "Host not found",
+		}
+	}
+
+	return this.commitHosts(this.hostsExcept(map[*hostEntry]bool{host: true}), nil, api.HandlerResponse{
+		Code:    http.StatusOK,
+		Message: "Successful deregistration",
+	})
+}
+
+// ReplaceHosts swaps the whole pool in one step. Hosts whose address is kept retain their health and
+// forwarding state, while the others are deregistered. Nothing changes when any spec is invalid.
+func (this *HostManager) ReplaceHosts(specs []api.HostSpec) api.HandlerResponse {
+	specs, err := normalizeHostSpecs(specs)
+	if err == nil {
+		err = this.validateLeaseTtls(specs)
+	}
+	if err != nil {
+		return api.HandlerResponse{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+
+	this.updateLock.Lock()
+	defer this.updateLock.Unlock()
+
+	hosts := make([]*hostEntry, 0, len(specs))
+	updates := map[*hostEntry]api.HostSpec{}
+	for _, spec := range specs {
+		host := this.findHost(spec.Address)
+		if host == nil {
+			spec.Origin = HostOriginApi
+			host = this.newHost(spec)
+		} else {
+			if spec.TtlSeconds > 0 && host.Origin != HostOriginApi {
+				return api.HandlerResponse{
+					Code:    http.StatusBadRequest,
+					Message: fmt.Sprintf("%s : %s", errDeclaredHostLease, spec.Address),
+				}
+			}
+
+			// kept hosts without an ID in their spec keep their current one
+			if spec.ID == "" {
+				spec.ID = host.ID
+			}
+			spec.Origin = host.Origin
+			updates[host] = spec
+		}
+		hosts = append(hosts, host)
+	}
+
+	if id := duplicateHostId(hosts, updates); id != "" {
+		return api.HandlerResponse{
+			Code:    http.StatusBadRequest,
+			Message: fmt.Sprintf("Duplicate host id detected : %s", id),
+		}
+	}
+
+	return this.commitHosts(hosts, updates, api.HandlerResponse{
+		Code:    http.StatusOK,
+		Message: "Successful replacement",
+	})
+}
+
+// ApplyHostBatch deregisters then registers hosts as a single operation, so a batch may replace a host
+// by another one using the same address. Nothing changes when any entry is invalid.
+func (this *HostManager) ApplyHostBatch(batch api.HostBatch) api.HandlerResponse {
+	specs, err := normalizeHostSpecs(batch.Register)
+	if err == nil {
+		err = this.validateLeaseTtls(specs)
+	}
+	if err != nil {
+		return api.HandlerResponse{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+
+	this.updateLock.Lock()
+	defer this.updateLock.Unlock()
+
+	removed := map[*hostEntry]bool{}
+	for _, ref := range batch.Deregister {
+		host := this.findHostByRef(ref)
+		if host == nil {
 			return api.HandlerResponse{
 				Code:    http.StatusBadRequest,
-				Message: "Duplicate host address detected",
+				Message: fmt.Sprintf("Host %s not found", ref),
 			}
 		}
+		removed[host] = true
 	}
 
-	this.hosts = append(this.hosts, api.Host{
-		Address:            hostAddress,
-		Healthy:            false,
-		RecentHealthChecks: []bool{},
-	})
+	hosts := this.hostsExcept(removed)
+	for _, spec := range specs {
+		for _, host := range hosts {
+			if host.Address == spec.Address || (spec.ID != "" && host.ID == spec.ID) {
+				return api.HandlerResponse{
+					Code:    http.StatusBadRequest,
+					Message: fmt.Sprintf("Host %s is already registered", spec.Address),
+				}
+			}
+		}
+	}
 
-	return api.HandlerResponse{
+	for _, spec := range specs {
+		spec.Origin = HostOriginApi
+		hosts = append(hosts, this.newHost(spec))
+	}
+
+	return this.commitHosts(hosts, nil, api.HandlerResponse{
 		Code:    http.StatusOK,
-		Message: "Successful registration",
+		Message: fmt.Sprintf("Registered %d and deregistered %d hosts", len(specs), len(removed)),
+	})
+}
+
+// SyncHosts reconciles the hosts registered from origin with specs : hosts missing from specs are
+// deregistered, new ones are registered and the weight and metadata of the others are updated, keeping
+// their health and forwarding state. Hosts of other origins are left alone, and specs sharing their
+// address are skipped. Nothing changes when any spec is invalid.
+func (this *HostManager) SyncHosts(origin string, specs []api.HostSpec) error {
+	specs, err := normalizeHostSpecs(specs)
+	if err != nil {
+		return err
+	}
+
+	this.updateLock.Lock()
+	defer this.updateLock.Unlock()
+
+	wanted := map[string]api.HostSpec{}
+	for i := range specs {
+		specs[i].Origin = origin
+		specs[i].Metadata = copyMetadata(specs[i].Metadata)
+		// declared hosts stay registered as long as their source lists them
+		specs[i].TtlSeconds = 0
+		wanted[specs[i].Address] = specs[i]
 	}
+
+	hosts := make([]*hostEntry, 0, len(this.hosts)+len(specs))
+	updates := map[*hostEntry]api.HostSpec{}
+	numRemoved := 0
+	for _, host := range this.hosts {
+		if host.Origin != origin {
+			hosts = append(hosts, host)
+			continue
+		}
+
+		spec, ok := wanted[host.Address]
+		if !ok {
+			numRemoved++
+			continue
+		}
+
+		if spec.ID == "" {
+			spec.ID = host.ID
+		}
+		if !reflect.DeepEqual(host.spec(), spec) {
+			updates[host] = spec
+		}
+		hosts = append(hosts, host)
+	}
+
+	numAdded := 0
+	for _, spec := range specs {
+		if this.findHost(spec.Address) == nil {
+			hosts = append(hosts, this.newHost(spec))
+			numAdded++
+		}
+	}
+
+	if id := duplicateHostId(hosts, updates); id != "" {
+		return fmt.Errorf("Duplicate host id detected : %s", id)
+	}
+
+	if numAdded == 0 && numRemoved == 0 && len(updates) == 0 {
+		return nil
+	}
+
+	response := this.commitHosts(hosts, updates, api.HandlerResponse{})
+	if response.Error != nil {
+		return response.Error
+	}
+
+	fmt.Println("synced", origin, "hosts :", numAdded, "added,", len(updates), "updated,", numRemoved, "removed")
+	return nil
 }
 
-func (this *HostManager) DeregisterHost(hostAddress string) api.HandlerResponse {
-	this.lock.Lock()
-	defer this.lock.Unlock()
+// UpdateHost changes the weight and metadata of the host referenced by ID or address.
+func (this *HostManager) UpdateHost(ref string, patch api.HostPatch) api.HandlerResponse {
+	if patch.Weight != nil && *patch.Weight < 1 {
+		return api.HandlerResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Host weight must be a positive number",
+		}
+	}
 
-	for i, host := range this.hosts {
-		if host.Address == hostAddress {
-			this.hosts = append(this.hosts[:i], this.hosts[i+1:]...)
+	if patch.TtlSeconds != nil {
+		if err := this.validateLeaseTtl(*patch.TtlSeconds); err != nil {
 			return api.HandlerResponse{
-				Code:    http.StatusOK,
-				Message: "Successful deregistration",
+				Code:    http.StatusBadRequest,
+				Message: err.Error(),
 			}
 		}
 	}
 
-	return api.HandlerResponse{
-		Code:    http.StatusBadRequest,
-		Message: "Host address not found",
+	this.updateLock.Lock()
+	defer this.updateLock.Unlock()
+
+	host := this.findHostByRef(ref)
+	if host == nil {
+		return api.HandlerResponse{
+			Code:    http.StatusNotFound,
+			Message: "Host not found",
+		}
+	}
+
+	if patch.TtlSeconds != nil && *patch.TtlSeconds > 0 && host.Origin != HostOriginApi {
+		return api.HandlerResponse{
+			Code:    http.StatusBadRequest,
+			Message: errDeclaredHostLease.Error(),
+		}
+	}
+
+	spec := host.spec()
+	if patch.Weight != nil {
+		spec.Weight = *patch.Weight
+	}
+	if patch.TtlSeconds != nil {
+		spec.TtlSeconds = *patch.TtlSeconds
+	}
+
+	for key, value := range patch.Metadata {
+		if value == nil {
+			delete(spec.Metadata, key)
+		} else {
+			spec.Metadata[key] = *value
+		}
 	}
+
+	return this.commitHosts(this.copyHosts(), map[*hostEntry]api.HostSpec{host: spec}, api.HandlerResponse{
+		Code:    http.StatusOK,
+		Message: "Successful update",
+	})
 }
 
+// GetEligibleHosts returns the healthy hosts. When too few hosts are healthy, the no healthy host policy
+// decides whether traffic spreads across every host instead. Hosts ejected by outlier detection are left
+// out in both cases.
 func (this *HostManager) GetEligibleHosts() []api.Host {
 	this.lock.RLock()
 	defer this.lock.RUnlock()
 
+	available, healthy := this.partitionHosts()
+	if this.isPanicking(len(healthy)) {
+		healthy = available
+	}
+
+	result := make([]api.Host, 0, len(healthy))
+	for _, host := range healthy {
+		result = append(result, host.routingView())
+	}
+	return result
+}
+
+// GetHosts returns every registered host, including the ones not eligible for routing.
+func (this *HostManager) GetHosts() []api.Host {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+
 	result := []api.Host{}
 	for _, host := range this.hosts {
-		if host.Healthy {
-			result = append(result, host)
+		result = append(result, this.describeHost(host))
+	}
+	return result
+}
+
+// GetHost returns the host referenced by ID or address.
+func (this *HostManager) GetHost(ref string) (api.Host, bool) {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+
+	host := this.findHostByRef(ref)
+	if host == nil {
+		return api.Host{}, false
+	}
+	return this.describeHost(host), true
+}
+
+// HealthSummary describes the no healthy host policy along with the host counts it's applied to.
+func (this *HostManager) HealthSummary() map[string]any {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+
+	available, healthy := this.partitionHosts()
+	summary := map[string]any{}
+	summary["noHealthyHostPolicy"] = this.noHealthyHostPolicy
+	if this.noHealthyHostPolicy == NoHealthyHostPanicThreshold {
+		summary["panicThresholdPercent"] = this.panicThresholdPercent
+	}
+	summary["registeredHosts"] = len(this.hosts)
+	summary["availableHosts"] = len(available)
+	summary["healthyHosts"] = len(healthy)
+	summary["panicMode"] = this.isPanicking(len(healthy))
+	return summary
+}
+
+// RetryAfter estimates when a host may become available again : the end of the earliest ejection when
+// hosts are ejected, otherwise the next round of health checks.
+func (this *HostManager) RetryAfter() time.Duration {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+
+	now := this.outlierDetector.now()
+	result := time.Duration(-1)
+	for _, host := range this.hosts {
+		host.stateLock.Lock()
+		if host.breaker.state == circuitOpen {
+			remaining := host.breaker.ejectedUntil.Sub(now)
+			if result < 0 || remaining < result {
+				result = remaining
+			}
 		}
+		host.stateLock.Unlock()
 	}
 
-	if len(result) > 0 {
-		return result
+	if result < 0 {
+		result = this.hcInterval
 	}
 
-	return this.hosts
+	if result < time.Second {
+		return time.Second
+	}
+	return result
 }
 
 // Private Functions
 
-func (this *HostManager) scheduleHealthChecks(duration time.Duration) {
-	ticker := time.NewTicker(duration)
+// trackAttempt counts the forwarding attempts of the host and feeds their outcome to outlier detection.
+// Only the state of the host itself gets locked, so concurrent requests don't contend on lock.
+func (this *HostManager) trackAttempt(hostAddress string) func(*http.Response, error) {
+	this.lock.RLock()
+	host := this.findHost(hostAddress)
+	this.lock.RUnlock()
+
+	if host == nil {
+		return func(*http.Response, error) {}
+	}
+
+	detectOutliers := this.outlierDetector.enabled()
+	if detectOutliers {
+		host.stateLock.Lock()
+		this.outlierDetector.attemptStarted(&host.breaker)
+		host.stateLock.Unlock()
+	}
+
+	return func(resp *http.Response, err error) {
+		host.stateLock.Lock()
+		defer host.stateLock.Unlock()
+
+		host.recordForwarding(resp, err)
+		if host.removed || !detectOutliers {
+			return
+		}
+
+		wasClosed := host.breaker.state == circuitClosed
+		shouldEject := this.outlierDetector.recordOutcome(&host.breaker, resp, err)
+		if !wasClosed && host.breaker.state == circuitClosed {
+			this.numEjected.Add(-1)
+		}
+		if !shouldEject {
+			return
+		}
+
+		// a failed probe re-ejects a host which already counts as ejected
+		if wasClosed && !this.reserveEjection() {
+			fmt.Println("outlier ejection skipped, max ejection percent reached for", host.Address)
+			return
+		}
+
+		duration := this.outlierDetector.eject(&host.breaker)
+		fmt.Println("ejected", host.Address, "for", duration)
+	}
+}
+
+// reserveEjection counts one more ejected host, unless it would exceed maxEjectionPercent.
+func (this *HostManager) reserveEjection() bool {
+	for {
+		numEjected := this.numEjected.Load()
+		if !this.outlierDetector.canEject(int(numEjected), int(this.numHosts.Load())) {
+			return false
+		}
+		if this.numEjected.CompareAndSwap(numEjected, numEjected+1) {
+			return true
+		}
+	}
+}
+
+func (this *HostManager) hasHost(hostAddress string) bool {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+
+	return this.findHost(hostAddress) != nil
+}
+
+func (this *HostManager) findHost(hostAddress string) *hostEntry {
+	return this.hostsByAddress[hostAddress]
+}
+
+func (this *HostManager) findHostByRef(ref string) *hostEntry {
+	for _, host := range this.hosts {
+		if host.ID == ref {
+			return host
+		}
+	}
+	return this.findHost(ref)
+}
 
+// commitHosts saves the new pool to the store then swaps it in, applying updates to the kept hosts and
+// marking the hosts left out as removed. Nothing changes when the store can't be written. Must be called
+// while holding updateLock.
+func (this *HostManager) commitHosts(hosts []*hostEntry, updates map[*hostEntry]api.HostSpec, success api.HandlerResponse) api.HandlerResponse {
+	if this.store != nil {
+		specs := persistedSpecs(hosts, updates)
+		if !reflect.DeepEqual(specs, persistedSpecs(this.hosts, nil)) {
+			err := this.store.Save(specs)
+			if err != nil {
+				return api.HandlerResponse{
+					Error: fmt.Errorf("failed saving hosts : %w", err),
+				}
+			}
+		}
+	}
+
+	now := this.now()
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	kept := map[*hostEntry]bool{}
+	for _, host := range hosts {
+		kept[host] = true
+	}
+	for _, host := range this.hosts {
+		if !kept[host] {
+			this.markRemoved(host)
+		}
+	}
+
+	for host, spec := range updates {
+		host.applySpec(spec, now)
+	}
+
+	// always a new slice, snapshots taken by scheduleHealthChecks keep their own view
+	this.indexHosts(hosts)
+	return success
+}
+
+// indexHosts swaps in the pool along with its address index. Must be called while holding both locks,
+// or before the HostManager is shared.
+func (this *HostManager) indexHosts(hosts []*hostEntry) {
+	hostsByAddress := make(map[string]*hostEntry, len(hosts))
+	for _, host := range hosts {
+		hostsByAddress[host.Address] = host
+	}
+
+	this.hosts = hosts
+	this.hostsByAddress = hostsByAddress
+	this.numHosts.Store(int32(len(hosts)))
+}
+
+// markRemoved flags a deregistered host, so in flight attempts and health checks leave it alone. Must be
+// called while holding both locks.
+func (this *HostManager) markRemoved(host *hostEntry) {
+	host.stateLock.Lock()
+	defer host.stateLock.Unlock()
+
+	host.removed = true
+	if host.breaker.state != circuitClosed {
+		this.numEjected.Add(-1)
+	}
+}
+
+// DefaultLeaseTtlSeconds is the ttl of hosts registered through /registerhost without one, zero when
+// they're registered without a lease.
+func (this *HostManager) DefaultLeaseTtlSeconds() int {
+	return this.defaultLeaseTtlSeconds
+}
+
+func (this *HostManager) validateLeaseTtl(ttlSeconds int) error {
+	if ttlSeconds < 0 {
+		return errors.New("Lease ttl must be a positive number")
+	}
+
+	if this.maxLeaseTtlSeconds > 0 && ttlSeconds > this.maxLeaseTtlSeconds {
+		return fmt.Errorf("Lease ttl must not exceed %d seconds", this.maxLeaseTtlSeconds)
+	}
+	return nil
+}
+
+func (this *HostManager) validateLeaseTtls(specs []api.HostSpec) error {
+	for _, spec := range specs {
+		if err := this.validateLeaseTtl(spec.TtlSeconds); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newHost creates the entry of a host about to be registered, starting its lease when it has one. It
+// must be called while holding updateLock.
+func (this *HostManager) newHost(spec api.HostSpec) *hostEntry {
+	host := newHostEntry(spec)
+	if spec.TtlSeconds > 0 {
+		host.renewLease(spec.TtlSeconds, this.now())
+	}
+	return host
+}
+
+// persistedSpecs returns the specs of the hosts registered through the api once updates are applied. Hosts
+// of other origins aren't persisted, they're rebuilt from their source on startup.
+func persistedSpecs(hosts []*hostEntry, updates map[*hostEntry]api.HostSpec) []api.HostSpec {
+	specs := []api.HostSpec{}
+	for _, host := range hosts {
+		spec, ok := updates[host]
+		if !ok {
+			spec = host.spec()
+		}
+		if spec.Origin != HostOriginApi {
+			continue
+		}
+		specs = append(specs, spec)
+	}
+	return specs
+}
+
+// duplicateHostId returns an ID shared by several of hosts once updates are applied, or an empty string.
+func duplicateHostId(hosts []*hostEntry, updates map[*hostEntry]api.HostSpec) string {
+	ids := map[string]bool{}
+	for _, host := range hosts {
+		id := host.ID
+		if update, ok := updates[host]; ok {
+			id = update.ID
+		}
+
+		if ids[id] {
+			return id
+		}
+		ids[id] = true
+	}
+	return ""
+}
+
+func (this *HostManager) copyHosts() []*hostEntry {
+	return append([]*hostEntry{}, this.hosts...)
+}
+
+func (this *HostManager) hostsExcept(excluded map[*hostEntry]bool) []*hostEntry {
+	hosts := make([]*hostEntry, 0, len(this.hosts))
+	for _, host := range this.hosts {
+		if !excluded[host] {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// describeHost returns a snapshot of the host along with its outlier detection state.
+func (this *HostManager) describeHost(host *hostEntry) api.Host {
+	result := host.snapshot()
+
+	host.stateLock.Lock()
+	defer host.stateLock.Unlock()
+
+	result.Forwarding = host.forwarding
+	if host.breaker.state == circuitOpen && this.outlierDetector.now().Before(host.breaker.ejectedUntil) {
+		ejectedUntil := host.breaker.ejectedUntil
+		result.Ejected = true
+		result.EjectedUntil = &ejectedUntil
+	}
+	return result
+}
+
+// partitionHosts returns the hosts not ejected by outlier detection, and the healthy ones among them.
+func (this *HostManager) partitionHosts() ([]*hostEntry, []*hostEntry) {
+	available := []*hostEntry{}
+	healthy := []*hostEntry{}
+	for _, host := range this.hosts {
+		host.stateLock.Lock()
+		isAvailable := this.outlierDetector.isAvailable(&host.breaker)
+		host.stateLock.Unlock()
+		if !isAvailable {
+			continue
+		}
+
+		available = append(available, host)
+		if host.Healthy {
+			healthy = append(healthy, host)
+		}
+	}
+	return available, healthy
+}
+
+// isPanicking tells whether traffic should spread across every available host given the number of
+// healthy hosts.
+func (this *HostManager) isPanicking(numHealthy int) bool {
+	switch this.noHealthyHostPolicy {
+	case NoHealthyHostFailClosed:
+		return false
+	case NoHealthyHostPanicThreshold:
+		return numHealthy*100 < len(this.hosts)*this.panicThresholdPercent
+	default:
+		return numHealthy == 0
+	}
+}
+
+func (this *HostManager) scheduleLeaseSweeps(duration time.Duration) {
+	ticker := time.NewTicker(duration)
 	for _ = range ticker.C {
-		for i, _ := range this.hosts {
-			go this.evaluateHostHealth(&this.hosts[i])
+		this.sweepExpiredLeases()
+	}
+}
+
+// sweepExpiredLeases deregisters the hosts whose lease wasn't renewed in time.
+func (this *HostManager) sweepExpiredLeases() {
+	this.updateLock.Lock()
+	defer this.updateLock.Unlock()
+
+	now := this.now()
+	expired := map[*hostEntry]bool{}
+	this.lock.RLock()
+	for _, host := range this.hosts {
+		if host.LeaseExpiresAt != nil && !now.Before(*host.LeaseExpiresAt) {
+			expired[host] = true
 		}
 	}
+	this.lock.RUnlock()
+
+	if len(expired) == 0 {
+		return
+	}
+
+	response := this.commitHosts(this.hostsExcept(expired), nil, api.HandlerResponse{})
+	if response.Error != nil {
+		fmt.Println("failed deregistering hosts with expired lease :", response.Error)
+		return
+	}
+
+	for host := range expired {
+		fmt.Println("lease expired for", host.Address)
+	}
+}
+
+func (this *HostManager) scheduleHealthChecks(duration time.Duration) {
+	ticker := time.NewTicker(duration)
+	for _ = range ticker.C {
+		this.runHealthChecks()
+	}
+}
+
+func (this *HostManager) runHealthChecks() {
+	this.lock.RLock()
+	hosts := this.hosts
+	this.lock.RUnlock()
+
+	for _, host := range hosts {
+		go this.evaluateHostHealth(host)
+	}
 }
 
-func (this *HostManager) evaluateHostHealth(host *api.Host) {
+func (this *HostManager) evaluateHostHealth(host *hostEntry) {
 	url := host.Address + this.hcPath
+	startedAt := time.Now()
 	response, err := this.client.Get(url)
+	result := &api.HealthCheckResult{
+		CheckedAt:     startedAt,
+		LatencyMillis: time.Since(startedAt).Milliseconds(),
+	}
+
 	var isHealthy bool
 	if err != nil {
 		isHealthy = false
+		result.Error = err.Error()
 	} else {
 		defer response.Body.Close()
 		isHealthy = response.StatusCode == http.StatusOK
+		if !isHealthy {
+			result.Error = fmt.Sprint("unexpected status ", response.StatusCode)
+		}
 	}
 
 	this.lock.Lock()
 	defer this.lock.Unlock()
 
+	if host.removed {
+		return
+	}
+
+	host.LastHealthCheck = result
+
 	if len(host.RecentHealthChecks) > 0 {
 		curr := host.RecentHealthChecks[0]
 		if isHealthy != curr {
 			host.RecentHealthChecks = []bool{}
 		}
 	}
-	host.RecentHealthChecks = append(host.RecentHealthChecks, isHealthy)
 
+	host.RecentHealthChecks = append(host.RecentHealthChecks, isHealthy)
 	if len(host.RecentHealthChecks) == this.numRequiredHC {
 		isHealthy = host.RecentHealthChecks[0]
 		if host.Healthy != isHealthy {
@@ -137,3 +1030,138 @@ func (this *HostManager) evaluateHostHealth(host *api.Host) {
 		host.RecentHealthChecks = []bool{}
 	}
 }
+
+func newHostEntry(spec api.HostSpec) *hostEntry {
+	id := spec.ID
+	if id == "" {
+		id = generateId(8)
+	}
+
+	return &hostEntry{
+		Host: api.Host{
+			ID:                 id,
+			Address:            spec.Address,
+			Weight:             spec.Weight,
+			Origin:             spec.Origin,
+			Metadata:           copyMetadata(spec.Metadata),
+			Healthy:            false,
+			RecentHealthChecks: []bool{},
+			RegisteredAt:       time.Now(),
+		},
+	}
+}
+
+// applySpec updates a kept host with a new spec, keeping its ID unless the spec sets one. Metadata is
+// replaced rather than modified in place, as snapshots may still share the previous map. A spec with a
+// ttl renews the lease of the host, while a spec without one removes it.
+func (this *hostEntry) applySpec(spec api.HostSpec, now time.Time) {
+	if spec.ID != "" {
+		this.ID = spec.ID
+	}
+	if spec.Origin != "" {
+		this.Origin = spec.Origin
+	}
+	this.Weight = spec.Weight
+	this.Metadata = copyMetadata(spec.Metadata)
+
+	if spec.TtlSeconds > 0 {
+		this.renewLease(spec.TtlSeconds, now)
+	} else {
+		this.LeaseTtlSeconds = 0
+		this.LeaseExpiresAt = nil
+	}
+}
+
+func (this *hostEntry) renewLease(ttlSeconds int, now time.Time) {
+	expiresAt := now.Add(time.Duration(ttlSeconds) * time.Second)
+	this.LeaseTtlSeconds = ttlSeconds
+	this.LeaseExpiresAt = &expiresAt
+}
+
+func (this *hostEntry) spec() api.HostSpec {
+	return api.HostSpec{
+		ID:         this.ID,
+		Address:    this.Address,
+		Weight:     this.Weight,
+		Metadata:   copyMetadata(this.Metadata),
+		TtlSeconds: this.LeaseTtlSeconds,
+		Origin:     this.Origin,
+	}
+}
+
+// routingView returns a copy of the host for routing decisions, taken on every forwarded request. Unlike
+// snapshot, Metadata is shared with the entry rather than copied, which is safe as applySpec replaces the
+// map instead of modifying it. It must not be modified.
+func (this *hostEntry) routingView() api.Host {
+	host := this.Host
+	host.RecentHealthChecks = nil
+	return host
+}
+
+// snapshot returns a copy of the host which is safe to use after the lock has been released.
+func (this *hostEntry) snapshot() api.Host {
+	host := this.Host
+	host.RecentHealthChecks = append([]bool{}, this.RecentHealthChecks...)
+	host.Metadata = copyMetadata(this.Metadata)
+	return host
+}
+
+// recordForwarding updates the forwarding counters with the outcome of an attempt. Must be called while
+// holding stateLock.
+func (this *hostEntry) recordForwarding(resp *http.Response, err error) {
+	now := time.Now()
+	this.forwarding.Requests++
+	this.forwarding.LastForwardedAt = &now
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		this.forwarding.Cancelled++
+	case isTimeout(err):
+		this.forwarding.Timeouts++
+		this.forwarding.Failures++
+	case err != nil || resp.StatusCode >= http.StatusInternalServerError:
+		this.forwarding.Failures++
+	}
+}
+
+// normalizeHostSpecs validates specs meant to be registered together and fills in the default weight.
+func normalizeHostSpecs(specs []api.HostSpec) ([]api.HostSpec, error) {
+	result := make([]api.HostSpec, 0, len(specs))
+	addresses := map[string]bool{}
+	ids := map[string]bool{}
+	for _, spec := range specs {
+		if spec.Address == "" {
+			return nil, errors.New("Host address is required")
+		}
+
+		if spec.Weight == 0 {
+			spec.Weight = defaultHostWeight
+		}
+		if spec.Weight < 1 {
+			return nil, errors.New("Host weight must be a positive number")
+		}
+
+		if addresses[spec.Address] || (spec.ID != "" && ids[spec.ID]) {
+			return nil, fmt.Errorf("Duplicate host detected : %s", spec.Address)
+		}
+		addresses[spec.Address] = true
+		ids[spec.ID] = true
+
+		result = append(result, spec)
+	}
+	return result, nil
+}
+
+func copyMetadata(metadata map[string]string) map[string]string {
+	result := map[string]string{}
+	for key, value := range metadata {
+		result[key] = value
+	}
+	return result
+}
+
+func generateId(numBytes int) string {
+	id := make([]byte, numBytes)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
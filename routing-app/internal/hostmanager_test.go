@@ -1,8 +1,12 @@
 package internal
 
 import (
+	"andrewsaputra/routing-app/api"
+	"context"
 	"errors"
+	"fmt"
 	"net/http"
+	"sync"
 	"testing"
 	"time"
 
@@ -32,6 +36,24 @@ func TestRegisterHost_Duplicate_ReturnStatusBadRequest(t *testing.T) {
 	assert.NoError(t, response.Error)
 }
 
+func TestRegisterWeightedHost_Valid_StoreWeight(t *testing.T) {
+	mgr := Helper_ConstructHostManager()
+	response := mgr.RegisterWeightedHost("http://localhost:7777", 5)
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, 5, mgr.hosts[0].Weight)
+}
+
+func TestRegisterWeightedHost_NonPositiveWeight_ReturnStatusBadRequest(t *testing.T) {
+	mgr := Helper_ConstructHostManager()
+	response := mgr.RegisterWeightedHost("http://localhost:7777", 0)
+
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.NotNil(t, response.Message)
+	assert.NoError(t, response.Error)
+	assert.Empty(t, mgr.hosts)
+}
+
 func TestDeRegisterHost_Valid_ReturnStatusOK(t *testing.T) {
 	mgr := Helper_ConstructHostManager()
 
@@ -69,13 +91,7 @@ func TestGetEligibleHosts_SomeHostsUnhealthy_ReturnHealthyHosts(t *testing.T) {
 
 	numHealthy := 0
 	for addr, healthy := range hostHealths {
-		for i, _ := range mgr.hosts {
-			host := &mgr.hosts[i]
-			if host.Address == addr {
-				host.Healthy = healthy
-				break
-			}
-		}
+		Helper_SetHostHealthy(mgr, addr, healthy)
 
 		if healthy {
 			numHealthy++
@@ -112,19 +128,464 @@ func TestGetEligibleHosts_AllHostsUnhealthy_ReturnAllHosts(t *testing.T) {
 	}
 }
 
+func TestGetEligibleHosts_FailClosedAllHostsUnhealthy_ReturnNoHosts(t *testing.T) {
+	mgr := Helper_ConstructHostManagerWithPolicy(NoHealthyHostFailClosed, 0)
+	mgr.RegisterHost("http://localhost:4001")
+	mgr.RegisterHost("http://localhost:4002")
+
+	assert.Empty(t, mgr.GetEligibleHosts())
+}
+
+func TestGetEligibleHosts_PanicThresholdNotReached_ReturnHealthyHosts(t *testing.T) {
+	mgr := Helper_ConstructHostManagerWithPolicy(NoHealthyHostPanicThreshold, 50)
+	for _, addr := range []string{"http://localhost:4001", "http://localhost:4002", "http://localhost:4003", "http://localhost:4004"} {
+		mgr.RegisterHost(addr)
+	}
+	Helper_SetHostHealthy(mgr, "http://localhost:4001", true)
+	Helper_SetHostHealthy(mgr, "http://localhost:4002", true)
+
+	eligibleHosts := mgr.GetEligibleHosts()
+
+	assert.Len(t, eligibleHosts, 2)
+	assert.Equal(t, false, mgr.HealthSummary()["panicMode"])
+}
+
+func TestGetEligibleHosts_PanicThresholdReached_ReturnAllHosts(t *testing.T) {
+	mgr := Helper_ConstructHostManagerWithPolicy(NoHealthyHostPanicThreshold, 50)
+	for _, addr := range []string{"http://localhost:4001", "http://localhost:4002", "http://localhost:4003", "http://localhost:4004"} {
+		mgr.RegisterHost(addr)
+	}
+	Helper_SetHostHealthy(mgr, "http://localhost:4001", true)
+
+	eligibleHosts := mgr.GetEligibleHosts()
+
+	assert.Len(t, eligibleHosts, 4)
+	assert.Equal(t, map[string]any{
+		"noHealthyHostPolicy":   NoHealthyHostPanicThreshold,
+		"panicThresholdPercent": 50,
+		"registeredHosts":       4,
+		"availableHosts":        4,
+		"healthyHosts":          1,
+		"panicMode":             true,
+	}, mgr.HealthSummary())
+}
+
+func TestValidateHealthCheckConfig_UnknownPolicy_ReturnError(t *testing.T) {
+	config := Helper_ConstructHealthCheckConfig()
+	assert.NoError(t, ValidateHealthCheckConfig(config))
+
+	config.NoHealthyHostPolicy = "FailSometimes"
+	assert.Error(t, ValidateHealthCheckConfig(config))
+
+	config.NoHealthyHostPolicy = NoHealthyHostPanicThreshold
+	config.PanicThresholdPercent = 150
+	assert.Error(t, ValidateHealthCheckConfig(config))
+}
+
+func TestHealthCheckEvaluation_HostReturnsError_RecordLastHealthCheck(t *testing.T) {
+	roundTripper := MockRoundTripper{}
+	roundTripper.On("RoundTrip", mock.Anything).
+		Return(&http.Response{StatusCode: http.StatusServiceUnavailable, Body: http.NoBody}, nil)
+	client := &http.Client{
+		Transport: &roundTripper,
+	}
+
+	mgr, _ := ConstructHostManager(client, Helper_ConstructHealthCheckConfig(), api.HostLeaseConfig{}, nil)
+	mgr.RegisterHost("http://localhost:4001")
+	host, _ := mgr.GetHost("http://localhost:4001")
+	assert.Nil(t, host.LastHealthCheck)
+	assert.False(t, host.RegisteredAt.IsZero())
+
+	mgr.evaluateHostHealth(mgr.hosts[0])
+
+	host, _ = mgr.GetHost("http://localhost:4001")
+	if assert.NotNil(t, host.LastHealthCheck) {
+		assert.Equal(t, "unexpected status 503", host.LastHealthCheck.Error)
+		assert.False(t, host.LastHealthCheck.CheckedAt.IsZero())
+	}
+}
+
+func TestTrackAttempt_AttemptOutcomes_UpdateForwardingCounters(t *testing.T) {
+	mgr := Helper_ConstructHostManager()
+	mgr.RegisterHost("http://localhost:4001")
+
+	mgr.trackAttempt("http://localhost:4001")(&http.Response{StatusCode: http.StatusOK}, nil)
+	mgr.trackAttempt("http://localhost:4001")(&http.Response{StatusCode: http.StatusBadGateway}, nil)
+	mgr.trackAttempt("http://localhost:4001")(nil, context.DeadlineExceeded)
+	mgr.trackAttempt("http://localhost:4001")(nil, context.Canceled)
+
+	host, ok := mgr.GetHost("http://localhost:4001")
+	assert.True(t, ok)
+	assert.Equal(t, int64(4), host.Forwarding.Requests)
+	assert.Equal(t, int64(2), host.Forwarding.Failures)
+	assert.Equal(t, int64(1), host.Forwarding.Timeouts)
+	assert.Equal(t, int64(1), host.Forwarding.Cancelled)
+	assert.NotNil(t, host.Forwarding.LastForwardedAt)
+}
+
+func TestTrackAttempt_ConcurrentAttempts_CountEveryAttempt(t *testing.T) {
+	mgr := Helper_ConstructHostManager()
+	mgr.RegisterHost("http://localhost:4001")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			mgr.trackAttempt("http://localhost:4001")(&http.Response{StatusCode: http.StatusOK}, nil)
+			mgr.GetEligibleHosts()
+		}()
+	}
+	wg.Wait()
+
+	host, _ := mgr.GetHost("http://localhost:4001")
+	assert.Equal(t, int64(50), host.Forwarding.Requests)
+}
+
+func TestGetHost_NotRegistered_ReturnNotFound(t *testing.T) {
+	mgr := Helper_ConstructHostManager()
+
+	_, ok := mgr.GetHost("http://localhost:4001")
+	assert.False(t, ok)
+}
+
+func TestReplaceHosts_ValidSpecs_ReplacePoolKeepingExistingState(t *testing.T) {
+	mgr := Helper_ConstructHostManager()
+	mgr.RegisterHost("http://localhost:4001")
+	mgr.RegisterHost("http://localhost:4002")
+	Helper_SetHostHealthy(mgr, "http://localhost:4001", true)
+	previous, _ := mgr.GetHost("http://localhost:4001")
+	removedEntry := mgr.hosts[1]
+
+	response := mgr.ReplaceHosts([]api.HostSpec{
+		{Address: "http://localhost:4001", Weight: 2, Metadata: map[string]string{"zone": "a"}},
+		{ID: "host-3", Address: "http://localhost:4003"},
+	})
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	hosts := mgr.GetHosts()
+	assert.Len(t, hosts, 2)
+	assert.Equal(t, previous.ID, hosts[0].ID)
+	assert.True(t, hosts[0].Healthy)
+	assert.Equal(t, 2, hosts[0].Weight)
+	assert.Equal(t, map[string]string{"zone": "a"}, hosts[0].Metadata)
+	assert.Equal(t, "host-3", hosts[1].ID)
+	assert.Equal(t, defaultHostWeight, hosts[1].Weight)
+	assert.True(t, removedEntry.removed)
+}
+
+func TestReplaceHosts_InvalidSpec_PoolUnchanged(t *testing.T) {
+	mgr := Helper_ConstructHostManager()
+	mgr.RegisterHost("http://localhost:4001")
+
+	for _, specs := range [][]api.HostSpec{
+		{{Address: "http://localhost:4002"}, {Address: ""}},
+		{{Address: "http://localhost:4002"}, {Address: "http://localhost:4002"}},
+		{{Address: "http://localhost:4002", Weight: -1}},
+		{{ID: "x", Address: "http://localhost:4002"}, {ID: "x", Address: "http://localhost:4003"}},
+	} {
+		response := mgr.ReplaceHosts(specs)
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+	}
+
+	hosts := mgr.GetHosts()
+	assert.Len(t, hosts, 1)
+	assert.Equal(t, "http://localhost:4001", hosts[0].Address)
+}
+
+func TestApplyHostBatch_RegisterAndDeregister_AppliedTogether(t *testing.T) {
+	mgr := Helper_ConstructHostManager()
+	mgr.RegisterHost("http://localhost:4001")
+	mgr.RegisterHost("http://localhost:4002")
+	existing, _ := mgr.GetHost("http://localhost:4002")
+
+	response := mgr.ApplyHostBatch(api.HostBatch{
+		Register:   []api.HostSpec{{Address: "http://localhost:4001"}, {Address: "http://localhost:4003"}},
+		Deregister: []string{"http://localhost:4001", existing.ID},
+	})
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	hosts := mgr.GetHosts()
+	assert.Len(t, hosts, 2)
+	assert.Equal(t, "http://localhost:4001", hosts[0].Address)
+	assert.Equal(t, "http://localhost:4003", hosts[1].Address)
+}
+
+func TestApplyHostBatch_InvalidEntry_PoolUnchanged(t *testing.T) {
+	mgr := Helper_ConstructHostManager()
+	mgr.RegisterHost("http://localhost:4001")
+
+	response := mgr.ApplyHostBatch(api.HostBatch{
+		Register:   []api.HostSpec{{Address: "http://localhost:4002"}},
+		Deregister: []string{"http://localhost:4009"},
+	})
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+
+	response = mgr.ApplyHostBatch(api.HostBatch{
+		Register: []api.HostSpec{{Address: "http://localhost:4002"}, {Address: "http://localhost:4001"}},
+	})
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+
+	hosts := mgr.GetHosts()
+	assert.Len(t, hosts, 1)
+	assert.Equal(t, "http://localhost:4001", hosts[0].Address)
+}
+
+func TestUpdateHost_WeightAndMetadata_MergeChanges(t *testing.T) {
+	mgr := Helper_ConstructHostManager()
+	mgr.ReplaceHosts([]api.HostSpec{{ID: "host-1", Address: "http://localhost:4001", Metadata: map[string]string{"zone": "a", "version": "1"}}})
+	before, _ := mgr.GetHost("host-1")
+
+	weight := 5
+	version := "2"
+	response := mgr.UpdateHost("host-1", api.HostPatch{
+		Weight:   &weight,
+		Metadata: map[string]*string{"version": &version, "zone": nil},
+	})
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	host, _ := mgr.GetHost("host-1")
+	assert.Equal(t, 5, host.Weight)
+	assert.Equal(t, map[string]string{"version": "2"}, host.Metadata)
+	assert.Equal(t, map[string]string{"zone": "a", "version": "1"}, before.Metadata)
+
+	weight = 0
+	assert.Equal(t, http.StatusBadRequest, mgr.UpdateHost("host-1", api.HostPatch{Weight: &weight}).Code)
+	assert.Equal(t, http.StatusNotFound, mgr.UpdateHost("unknown", api.HostPatch{}).Code)
+}
+
+func TestRemoveHost_ById_HostDeregistered(t *testing.T) {
+	mgr := Helper_ConstructHostManager()
+	mgr.ReplaceHosts([]api.HostSpec{{ID: "host-1", Address: "http://localhost:4001"}, {Address: "http://localhost:4002"}})
+
+	assert.Equal(t, http.StatusOK, mgr.RemoveHost("host-1").Code)
+	assert.Equal(t, http.StatusNotFound, mgr.RemoveHost("host-1").Code)
+
+	hosts := mgr.GetHosts()
+	assert.Len(t, hosts, 1)
+	assert.Equal(t, "http://localhost:4002", hosts[0].Address)
+}
+
+func TestSyncHosts_ChangedSpecs_ReconcileOwnOriginOnly(t *testing.T) {
+	mgr := Helper_ConstructHostManager()
+	mgr.RegisterHost("http://localhost:4001")
+	err := mgr.SyncHosts(HostOriginFile, []api.HostSpec{
+		{ID: "host-2", Address: "http://localhost:4002"},
+		{Address: "http://localhost:4003", Metadata: map[string]string{"zone": "a"}},
+	})
+	assert.NoError(t, err)
+	Helper_SetHostHealthy(mgr, "http://localhost:4003", true)
+	previous, _ := mgr.GetHost("http://localhost:4003")
+
+	err = mgr.SyncHosts(HostOriginFile, []api.HostSpec{
+		{Address: "http://localhost:4003", Weight: 2, Metadata: map[string]string{"zone": "b"}},
+		{Address: "http://localhost:4004"},
+	})
+	assert.NoError(t, err)
+
+	hosts := mgr.GetHosts()
+	assert.Len(t, hosts, 3)
+	assert.Equal(t, "http://localhost:4001", hosts[0].Address)
+	assert.Equal(t, HostOriginApi, hosts[0].Origin)
+	assert.Equal(t, previous.ID, hosts[1].ID)
+	assert.True(t, hosts[1].Healthy)
+	assert.Equal(t, 2, hosts[1].Weight)
+	assert.Equal(t, map[string]string{"zone": "b"}, hosts[1].Metadata)
+	assert.Equal(t, HostOriginFile, hosts[1].Origin)
+	assert.Equal(t, "http://localhost:4004", hosts[2].Address)
+	assert.Equal(t, HostOriginFile, hosts[2].Origin)
+}
+
+func TestSyncHosts_AddressOfOtherOrigin_LeaveHostUntouched(t *testing.T) {
+	mgr := Helper_ConstructHostManager()
+	mgr.RegisterWeightedHost("http://localhost:4001", 3)
+	previous, _ := mgr.GetHost("http://localhost:4001")
+
+	specs := []api.HostSpec{{Address: "http://localhost:4001", Weight: 1}, {Address: "http://localhost:4002"}}
+	assert.NoError(t, mgr.SyncHosts(HostOriginConfig, specs))
+	hosts := mgr.GetHosts()
+	assert.Len(t, hosts, 2)
+	assert.Equal(t, previous.ID, hosts[0].ID)
+	assert.Equal(t, HostOriginApi, hosts[0].Origin)
+	assert.Equal(t, 3, hosts[0].Weight)
+	assert.Equal(t, HostOriginConfig, hosts[1].Origin)
+
+	assert.NoError(t, mgr.SyncHosts(HostOriginConfig, []api.HostSpec{}))
+	hosts = mgr.GetHosts()
+	assert.Len(t, hosts, 1)
+	assert.Equal(t, "http://localhost:4001", hosts[0].Address)
+}
+
+func TestSyncHosts_InvalidSpecs_PoolUnchanged(t *testing.T) {
+	mgr := Helper_ConstructHostManager()
+	mgr.ReplaceHosts([]api.HostSpec{{ID: "host-1", Address: "http://localhost:4001"}})
+
+	assert.Error(t, mgr.SyncHosts(HostOriginFile, []api.HostSpec{{Address: "http://localhost:4002", Weight: -1}}))
+	assert.Error(t, mgr.SyncHosts(HostOriginFile, []api.HostSpec{{ID: "host-1", Address: "http://localhost:4002"}}))
+
+	hosts := mgr.GetHosts()
+	assert.Len(t, hosts, 1)
+	assert.Equal(t, HostOriginApi, hosts[0].Origin)
+}
+
+func TestSyncHosts_DeclaredHosts_NotPersisted(t *testing.T) {
+	store := &MockHostStore{}
+	store.On("Load").Return([]api.HostSpec{
+		{ID: "host-1", Address: "http://localhost:4001"},
+		{ID: "host-2", Address: "http://localhost:4002", Origin: HostOriginFile},
+	}, nil)
+	mgr, _ := ConstructHostManager(Helper_ConstructMockHttpClient(), Helper_ConstructHealthCheckConfig(), api.HostLeaseConfig{}, store)
+
+	hosts := mgr.GetHosts()
+	assert.Len(t, hosts, 1)
+	assert.Equal(t, HostOriginApi, hosts[0].Origin)
+
+	err := mgr.SyncHosts(HostOriginConfig, []api.HostSpec{{Address: "http://localhost:4003"}})
+	assert.NoError(t, err)
+	assert.Len(t, mgr.GetHosts(), 2)
+	store.AssertNotCalled(t, "Save", mock.Anything)
+
+	store.On("Save", mock.Anything).Return(nil)
+	mgr.RegisterHost("http://localhost:4004")
+	saved := store.Calls[len(store.Calls)-1].Arguments.Get(0).([]api.HostSpec)
+	assert.Len(t, saved, 2)
+	assert.Equal(t, "http://localhost:4001", saved[0].Address)
+	assert.Equal(t, "http://localhost:4004", saved[1].Address)
+}
+
+func TestRegisterLeasedHost_LeaseLapsed_HostDeregistered(t *testing.T) {
+	mgr := Helper_ConstructHostManager()
+	clock := Helper_SetFakeClock(mgr)
+	mgr.RegisterHost("http://localhost:4001")
+	mgr.RegisterLeasedHost("http://localhost:4002", 1, 10)
+	mgr.RegisterLeasedHost("http://localhost:4003", 1, 30)
+
+	clock.Advance(8 * time.Second)
+	assert.Equal(t, http.StatusOK, mgr.RenewLease("http://localhost:4002").Code)
+
+	clock.Advance(9 * time.Second)
+	mgr.sweepExpiredLeases()
+	assert.Len(t, mgr.GetHosts(), 3)
+
+	clock.Advance(time.Second)
+	mgr.sweepExpiredLeases()
+	hosts := mgr.GetHosts()
+	assert.Len(t, hosts, 2)
+	assert.Equal(t, "http://localhost:4001", hosts[0].Address)
+	assert.Nil(t, hosts[0].LeaseExpiresAt)
+	assert.Equal(t, "http://localhost:4003", hosts[1].Address)
+	assert.Equal(t, http.StatusNotFound, mgr.RenewLease("http://localhost:4002").Code)
+}
+
+func TestRegisterLeasedHost_AlreadyRegistered_RenewLeaseOrReject(t *testing.T) {
+	mgr := Helper_ConstructHostManager()
+	mgr.RegisterHost("http://localhost:4001")
+	mgr.RegisterLeasedHost("http://localhost:4002", 1, 10)
+	previous, _ := mgr.GetHost("http://localhost:4002")
+
+	response := mgr.RegisterLeasedHost("http://localhost:4002", 2, 20)
+	assert.Equal(t, http.StatusOK, response.Code)
+	host, _ := mgr.GetHost("http://localhost:4002")
+	assert.Equal(t, previous.ID, host.ID)
+	assert.Equal(t, 2, host.Weight)
+	assert.True(t, host.LeaseExpiresAt.After(*previous.LeaseExpiresAt))
+
+	// hosts registered without a lease aren't turned into leased ones
+	assert.Equal(t, http.StatusBadRequest, mgr.RegisterLeasedHost("http://localhost:4001", 1, 10).Code)
+	assert.Equal(t, http.StatusBadRequest, mgr.RenewLease("http://localhost:4001").Code)
+}
+
+func TestHostLease_OtherRegistrationPaths_LeaseAppliedOrRemoved(t *testing.T) {
+	mgr := Helper_ConstructHostManager()
+	mgr.ReplaceHosts([]api.HostSpec{{ID: "host-1", Address: "http://localhost:4001", TtlSeconds: 10}})
+	mgr.ApplyHostBatch(api.HostBatch{Register: []api.HostSpec{{Address: "http://localhost:4002", TtlSeconds: 20}}})
+
+	hosts := mgr.GetHosts()
+	assert.Equal(t, 10, hosts[0].LeaseTtlSeconds)
+	assert.NotNil(t, hosts[0].LeaseExpiresAt)
+	assert.Equal(t, 20, hosts[1].LeaseTtlSeconds)
+
+	ttl := 0
+	assert.Equal(t, http.StatusOK, mgr.UpdateHost("host-1", api.HostPatch{TtlSeconds: &ttl}).Code)
+	host, _ := mgr.GetHost("host-1")
+	assert.Equal(t, 0, host.LeaseTtlSeconds)
+	assert.Nil(t, host.LeaseExpiresAt)
+
+	// declared hosts don't hold leases, and leave the leased hosts sharing their address alone
+	mgr.SyncHosts(HostOriginConfig, []api.HostSpec{
+		{Address: "http://localhost:4002", TtlSeconds: 5},
+		{Address: "http://localhost:4003", TtlSeconds: 5},
+	})
+	host, _ = mgr.GetHost("http://localhost:4002")
+	assert.Equal(t, HostOriginApi, host.Origin)
+	assert.Equal(t, 20, host.LeaseTtlSeconds)
+	assert.NotNil(t, host.LeaseExpiresAt)
+
+	host, _ = mgr.GetHost("http://localhost:4003")
+	assert.Equal(t, 0, host.LeaseTtlSeconds)
+	assert.Nil(t, host.LeaseExpiresAt)
+}
+
+func TestHostLease_DeclaredHost_ReturnBadRequest(t *testing.T) {
+	mgr := Helper_ConstructHostManager()
+	mgr.SyncHosts(HostOriginConfig, []api.HostSpec{{ID: "host-1", Address: "http://localhost:4001"}})
+
+	ttl := 5
+	assert.Equal(t, http.StatusBadRequest, mgr.UpdateHost("host-1", api.HostPatch{TtlSeconds: &ttl}).Code)
+	assert.Equal(t, http.StatusBadRequest, mgr.ReplaceHosts([]api.HostSpec{{Address: "http://localhost:4001", TtlSeconds: 5}}).Code)
+
+	ttl = 0
+	assert.Equal(t, http.StatusOK, mgr.UpdateHost("host-1", api.HostPatch{TtlSeconds: &ttl}).Code)
+	assert.Equal(t, http.StatusOK, mgr.ReplaceHosts([]api.HostSpec{{Address: "http://localhost:4001"}}).Code)
+
+	host, _ := mgr.GetHost("host-1")
+	assert.Equal(t, HostOriginConfig, host.Origin)
+	assert.Equal(t, 0, host.LeaseTtlSeconds)
+	assert.Nil(t, host.LeaseExpiresAt)
+}
+
+func TestHostLease_AboveMaxTtl_ReturnBadRequest(t *testing.T) {
+	mgr, _ := ConstructHostManager(Helper_ConstructMockHttpClient(), Helper_ConstructHealthCheckConfig(), api.HostLeaseConfig{MaxTtlSeconds: 60}, nil)
+	mgr.RegisterHost("http://localhost:4001")
+
+	ttl := 61
+	assert.Equal(t, http.StatusBadRequest, mgr.RegisterLeasedHost("http://localhost:4002", 1, 61).Code)
+	assert.Equal(t, http.StatusBadRequest, mgr.RegisterLeasedHost("http://localhost:4002", 1, -1).Code)
+	assert.Equal(t, http.StatusBadRequest, mgr.ReplaceHosts([]api.HostSpec{{Address: "http://localhost:4002", TtlSeconds: 61}}).Code)
+	assert.Equal(t, http.StatusBadRequest, mgr.ApplyHostBatch(api.HostBatch{Register: []api.HostSpec{{Address: "http://localhost:4002", TtlSeconds: -1}}}).Code)
+	assert.Equal(t, http.StatusBadRequest, mgr.UpdateHost("http://localhost:4001", api.HostPatch{TtlSeconds: &ttl}).Code)
+
+	assert.Equal(t, http.StatusOK, mgr.RegisterLeasedHost("http://localhost:4002", 1, 60).Code)
+	assert.Len(t, mgr.GetHosts(), 2)
+}
+
+func TestValidateHostLeaseConfig_InvalidSettings_ReturnError(t *testing.T) {
+	assert.NoError(t, ValidateHostLeaseConfig(api.HostLeaseConfig{DefaultTtlSeconds: 30, MaxTtlSeconds: 60, SweepIntervalSeconds: 1}))
+	assert.Error(t, ValidateHostLeaseConfig(api.HostLeaseConfig{DefaultTtlSeconds: 90, MaxTtlSeconds: 60}))
+	assert.Error(t, ValidateHostLeaseConfig(api.HostLeaseConfig{SweepIntervalSeconds: -1}))
+}
+
+func Helper_ConstructHostManagerWithPolicy(policy string, panicThresholdPercent int) *HostManager {
+	config := Helper_ConstructHealthCheckConfig()
+	config.NoHealthyHostPolicy = policy
+	config.PanicThresholdPercent = panicThresholdPercent
+	mgr, _ := ConstructHostManager(Helper_ConstructMockHttpClient(), config, api.HostLeaseConfig{}, nil)
+	return mgr
+}
+
 func TestHealthCheckEvaluation_MultipleHostRegistered_EvaluationTriggered(t *testing.T) {
 	config := Helper_ConstructHealthCheckConfig()
 	config.IntervalSeconds = 1
 
 	roundTripper := MockRoundTripper{}
 	roundTripper.On("RoundTrip", mock.Anything).
-		Return(&http.Response{StatusCode: http.StatusOK}, nil)
+		Return(&http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil)
 
 	client := &http.Client{
 		Transport: &roundTripper,
 	}
 
-	mgr := ConstructHostManager(client, config)
+	mgr, _ := ConstructHostManager(client, config, api.HostLeaseConfig{}, nil)
 
 	hostAddresses := []string{"http://localhost:4001", "http://localhost:4002"}
 	for _, addr := range hostAddresses {
@@ -144,20 +605,20 @@ func TestHealthCheckEvaluation_HostReturnsHealthy_UpdateStatusToHealthy(t *testi
 
 	roundTripper := MockRoundTripper{}
 	roundTripper.On("RoundTrip", mock.Anything).
-		Return(&http.Response{StatusCode: http.StatusOK}, nil)
+		Return(&http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil)
 
 	client := &http.Client{
 		Transport: &roundTripper,
 	}
 
-	mgr := ConstructHostManager(client, config)
+	mgr, _ := ConstructHostManager(client, config, api.HostLeaseConfig{}, nil)
 
 	hostAddresses := []string{"http://localhost:4001", "http://localhost:4002"}
 	for _, addr := range hostAddresses {
 		mgr.RegisterHost(addr)
 	}
 
-	for _, host := range mgr.hosts {
+	for _, host := range Helper_GetHosts(mgr) {
 		assert.False(t, host.Healthy)
 	}
 
@@ -165,7 +626,7 @@ func TestHealthCheckEvaluation_HostReturnsHealthy_UpdateStatusToHealthy(t *testi
 	<-timer.C
 
 	roundTripper.AssertNumberOfCalls(t, "RoundTrip", len(hostAddresses))
-	for _, host := range mgr.hosts {
+	for _, host := range Helper_GetHosts(mgr) {
 		assert.False(t, host.Healthy)
 	}
 
@@ -173,7 +634,7 @@ func TestHealthCheckEvaluation_HostReturnsHealthy_UpdateStatusToHealthy(t *testi
 	<-timer.C
 
 	roundTripper.AssertNumberOfCalls(t, "RoundTrip", 2*len(hostAddresses))
-	for _, host := range mgr.hosts {
+	for _, host := range Helper_GetHosts(mgr) {
 		assert.True(t, host.Healthy)
 	}
 }
@@ -191,14 +652,109 @@ func TestHealthCheckEvaluation_HostUnreachable_UpdateStatusToUnhealthy(t *testin
 		Transport: &roundTripper,
 	}
 
-	mgr := ConstructHostManager(client, config)
+	mgr, _ := ConstructHostManager(client, config, api.HostLeaseConfig{}, nil)
 	mgr.RegisterHost("http://localhost:4001")
-	mgr.hosts[0].Healthy = true
-	assert.True(t, mgr.hosts[0].Healthy)
+	Helper_SetHostHealthy(mgr, "http://localhost:4001", true)
+	assert.True(t, Helper_GetHosts(mgr)[0].Healthy)
 
 	timer := time.NewTimer(1100 * time.Millisecond)
 	<-timer.C
 
 	roundTripper.AssertNumberOfCalls(t, "RoundTrip", 1)
-	assert.False(t, mgr.hosts[0].Healthy)
+	assert.False(t, Helper_GetHosts(mgr)[0].Healthy)
+}
+
+func TestHealthCheckEvaluation_DeregisteredDuringProbe_ResultDiscarded(t *testing.T) {
+	config := Helper_ConstructHealthCheckConfig()
+	config.IntervalSeconds = 3600
+	config.NumRequired = 1
+
+	roundTripper := &BlockingRoundTripper{
+		started: make(chan struct{}, 1),
+		release: make(chan struct{}),
+	}
+	client := &http.Client{
+		Transport: roundTripper,
+	}
+
+	mgr, _ := ConstructHostManager(client, config, api.HostLeaseConfig{}, nil)
+	hostAddress := "http://localhost:4001"
+	mgr.RegisterHost(hostAddress)
+
+	mgr.lock.RLock()
+	probedHost := mgr.hosts[0]
+	mgr.lock.RUnlock()
+
+	done := make(chan struct{})
+	go func() {
+		mgr.evaluateHostHealth(probedHost)
+		close(done)
+	}()
+	<-roundTripper.started
+
+	mgr.DeregisterHost(hostAddress)
+	mgr.RegisterHost(hostAddress)
+	close(roundTripper.release)
+	<-done
+
+	hosts := Helper_GetHosts(mgr)
+	assert.Len(t, hosts, 1)
+	assert.False(t, hosts[0].Healthy)
+	assert.Empty(t, hosts[0].RecentHealthChecks)
+}
+
+func TestHealthCheckEvaluation_ConcurrentRegistrations_KeepHostsConsistent(t *testing.T) {
+	config := Helper_ConstructHealthCheckConfig()
+	config.IntervalSeconds = 3600
+	config.NumRequired = 1
+	mgr, _ := ConstructHostManager(Helper_ConstructMockHttpClient(), config, api.HostLeaseConfig{}, nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			hostAddress := fmt.Sprint("http://localhost:", 4000+i)
+			for j := 0; j < 20; j++ {
+				mgr.RegisterHost(hostAddress)
+				mgr.DeregisterHost(hostAddress)
+			}
+			mgr.RegisterHost(hostAddress)
+		}(i)
+
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				mgr.runHealthChecks()
+				mgr.GetEligibleHosts()
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(t, Helper_GetHosts(mgr), 20)
+}
+
+func TestGetEligibleHosts_ModifyResult_HostManagerUnchanged(t *testing.T) {
+	mgr := Helper_ConstructHostManager()
+	mgr.RegisterHost("http://localhost:4001")
+
+	eligibleHosts := mgr.GetEligibleHosts()
+	eligibleHosts[0].Healthy = true
+	eligibleHosts[0].RecentHealthChecks = append(eligibleHosts[0].RecentHealthChecks, true)
+
+	hosts := Helper_GetHosts(mgr)
+	assert.False(t, hosts[0].Healthy)
+	assert.Empty(t, hosts[0].RecentHealthChecks)
+}
+
+type BlockingRoundTripper struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (this *BlockingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	this.started <- struct{}{}
+	<-this.release
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
 }
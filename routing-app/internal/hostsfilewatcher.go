@@ -0,0 +1,73 @@
+package internal
+
+import (
+	"andrewsaputra/routing-app/api"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+const defaultHostsFilePollIntervalSeconds = 5
+
+func ConstructHostsFileWatcher(hostManager *HostManager, config api.HostsFileConfig) *HostsFileWatcher {
+	interval := config.PollIntervalSeconds
+	if interval <= 0 {
+		interval = defaultHostsFilePollIntervalSeconds
+	}
+
+	return &HostsFileWatcher{
+		hostManager: hostManager,
+		path:        config.Path,
+		interval:    time.Duration(interval) * time.Second,
+	}
+}
+
+// HostsFileWatcher keeps the hosts listed in a json file registered, using the same format as the json
+// file host store. The file is polled and reconciled into the pool on every poll, so changes apply without
+// restarts and file hosts deregistered through the api come back. A file which can't be read or holds
+// invalid hosts is ignored, leaving the pool as it was.
+type HostsFileWatcher struct {
+	hostManager *HostManager
+	path        string
+	interval    time.Duration
+}
+
+// Sync reconciles the pool with the file. Nothing changes when the pool already matches it.
+func (this *HostsFileWatcher) Sync() error {
+	raw, err := os.ReadFile(this.path)
+	if err != nil {
+		return err
+	}
+
+	var content jsonFileHosts
+	err = json.Unmarshal(raw, &content)
+	if err != nil {
+		return fmt.Errorf("invalid hosts file %s : %w", this.path, err)
+	}
+
+	err = this.hostManager.SyncHosts(HostOriginFile, content.Hosts)
+	if err != nil {
+		return fmt.Errorf("invalid hosts file %s : %w", this.path, err)
+	}
+	return nil
+}
+
+// Watch polls the file forever, it's meant to run in its own goroutine after the first Sync.
+func (this *HostsFileWatcher) Watch() {
+	var lastErr string
+	ticker := time.NewTicker(this.interval)
+	for _ = range ticker.C {
+		err := this.Sync()
+		if err == nil {
+			lastErr = ""
+			continue
+		}
+
+		// avoid repeating the same error on every poll
+		if err.Error() != lastErr {
+			fmt.Println("failed syncing hosts file :", err)
+			lastErr = err.Error()
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package internal
+
+import (
+	"andrewsaputra/routing-app/api"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHostsFileWatcher_FileChanged_ReconcilePool(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts.json")
+	os.WriteFile(path, []byte(`{"hosts": [{"address": "http://localhost:4001"}, {"address": "http://localhost:4002", "weight": 2}]}`), 0o644)
+	mgr := Helper_ConstructHostManager()
+	mgr.RegisterHost("http://localhost:4009")
+	watcher := ConstructHostsFileWatcher(mgr, api.HostsFileConfig{Path: path})
+
+	assert.NoError(t, watcher.Sync())
+	hosts := mgr.GetHosts()
+	assert.Len(t, hosts, 3)
+	assert.Equal(t, HostOriginFile, hosts[1].Origin)
+	assert.Equal(t, 2, hosts[2].Weight)
+
+	os.WriteFile(path, []byte(`{"hosts": [{"address": "http://localhost:4002", "metadata": {"zone": "a"}}]}`), 0o644)
+
+	assert.NoError(t, watcher.Sync())
+	hosts = mgr.GetHosts()
+	assert.Len(t, hosts, 2)
+	assert.Equal(t, "http://localhost:4009", hosts[0].Address)
+	assert.Equal(t, "http://localhost:4002", hosts[1].Address)
+	assert.Equal(t, defaultHostWeight, hosts[1].Weight)
+	assert.Equal(t, map[string]string{"zone": "a"}, hosts[1].Metadata)
+}
+
+func TestHostsFileWatcher_InvalidFile_PoolUnchanged(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts.json")
+	os.WriteFile(path, []byte(`{"hosts": [{"address": "http://localhost:4001"}]}`), 0o644)
+	mgr := Helper_ConstructHostManager()
+	watcher := ConstructHostsFileWatcher(mgr, api.HostsFileConfig{Path: path})
+	assert.NoError(t, watcher.Sync())
+
+	os.WriteFile(path, []byte(`{"hosts": [{"address": "http://localhost:4002"`), 0o644)
+	assert.Error(t, watcher.Sync())
+
+	os.WriteFile(path, []byte(`{"hosts": [{"address": ""}]}`), 0o644)
+	assert.Error(t, watcher.Sync())
+
+	os.Remove(path)
+	assert.Error(t, watcher.Sync())
+
+	hosts := mgr.GetHosts()
+	assert.Len(t, hosts, 1)
+	assert.Equal(t, "http://localhost:4001", hosts[0].Address)
+}
+
+func TestHostsFileWatcher_FileHostDeregistered_RestoredOnNextSync(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts.json")
+	os.WriteFile(path, []byte(`{"hosts": [{"address": "http://localhost:4001"}]}`), 0o644)
+	mgr := Helper_ConstructHostManager()
+	watcher := ConstructHostsFileWatcher(mgr, api.HostsFileConfig{Path: path})
+	assert.NoError(t, watcher.Sync())
+
+	mgr.DeregisterHost("http://localhost:4001")
+	assert.Empty(t, mgr.GetHosts())
+
+	assert.NoError(t, watcher.Sync())
+	hosts := mgr.GetHosts()
+	assert.Len(t, hosts, 1)
+	assert.Equal(t, "http://localhost:4001", hosts[0].Address)
+	assert.Equal(t, HostOriginFile, hosts[0].Origin)
+}
@@ -0,0 +1,138 @@
+package internal
+
+import (
+	"andrewsaputra/routing-app/api"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	HostStoreNone     = ""
+	HostStoreJsonFile = "JsonFile"
+	HostStoreLogFile  = "LogFile"
+)
+
+// HostStore persists the registered hosts so the pool survives restarts. Save receives the whole pool
+// after every change and must not leave a partially written pool behind when interrupted.
+type HostStore interface {
+	Load() ([]api.HostSpec, error)
+	Save(hosts []api.HostSpec) error
+}
+
+// ConstructHostStore returns the store selected by config, or nil when hosts aren't persisted.
+func ConstructHostStore(config api.HostStoreConfig) (HostStore, error) {
+	switch config.Type {
+	case HostStoreNone:
+		return nil, nil
+	case HostStoreJsonFile:
+		if config.Path == "" {
+			return nil, errors.New("host store path is required")
+		}
+		return ConstructJsonFileHostStore(config.Path), nil
+	case HostStoreLogFile:
+		if config.Path == "" {
+			return nil, errors.New("host store path is required")
+		}
+		return ConstructLogFileHostStore(config.Path)
+	default:
+		return nil, fmt.Errorf("unsupported host store type %q", config.Type)
+	}
+}
+
+func ConstructJsonFileHostStore(path string) *JsonFileHostStore {
+	return &JsonFileHostStore{
+		path: path,
+	}
+}
+
+// JsonFileHostStore keeps the pool in a single json file, rewritten as a whole on every change.
+type JsonFileHostStore struct {
+	path string
+	lock sync.Mutex
+}
+
+type jsonFileHosts struct {
+	Hosts []api.HostSpec `json:"hosts"`
+}
+
+func (this *JsonFileHostStore) Load() ([]api.HostSpec, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	raw, err := os.ReadFile(this.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return []api.HostSpec{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var content jsonFileHosts
+	err = json.Unmarshal(raw, &content)
+	if err != nil {
+		return nil, err
+	}
+	return content.Hosts, nil
+}
+
+func (this *JsonFileHostStore) Save(hosts []api.HostSpec) error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	raw, err := json.MarshalIndent(jsonFileHosts{Hosts: hosts}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(this.path, raw)
+}
+
+// Private Functions
+
+// writeFileAtomic replaces the file at path with data. The data is written and synced to a temporary
+// file in the same directory which is then renamed over path, so a crash leaves either the previous or
+// the new content but never a mix of both.
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// syncDir makes a rename within dir durable.
+func syncDir(dir string) error {
+	file, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return file.Sync()
+}
@@ -0,0 +1,143 @@
+package internal
+
+import (
+	"andrewsaputra/routing-app/api"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockHostStore struct {
+	mock.Mock
+}
+
+func (this *MockHostStore) Load() ([]api.HostSpec, error) {
+	args := this.Called()
+	return args.Get(0).([]api.HostSpec), args.Error(1)
+}
+
+func (this *MockHostStore) Save(hosts []api.HostSpec) error {
+	args := this.Called(hosts)
+	return args.Error(0)
+}
+
+func TestConstructHostStore_UnsupportedType_ReturnError(t *testing.T) {
+	_, err := ConstructHostStore(api.HostStoreConfig{Type: "Bolt", Path: "hosts.db"})
+	assert.Error(t, err)
+
+	_, err = ConstructHostStore(api.HostStoreConfig{Type: HostStoreJsonFile})
+	assert.Error(t, err)
+
+	store, err := ConstructHostStore(api.HostStoreConfig{})
+	assert.NoError(t, err)
+	assert.Nil(t, store)
+}
+
+func TestJsonFileHostStore_MissingFile_LoadEmpty(t *testing.T) {
+	store := ConstructJsonFileHostStore(filepath.Join(t.TempDir(), "hosts.json"))
+
+	hosts, err := store.Load()
+	assert.NoError(t, err)
+	assert.Empty(t, hosts)
+}
+
+func TestJsonFileHostStore_SaveThenLoad_RoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	store := ConstructJsonFileHostStore(filepath.Join(dir, "data", "hosts.json"))
+	specs := []api.HostSpec{
+		{ID: "host-1", Address: "http://localhost:4001", Weight: 1, Metadata: map[string]string{"zone": "a"}},
+		{ID: "host-2", Address: "http://localhost:4002", Weight: 3, Metadata: map[string]string{}},
+	}
+
+	assert.NoError(t, store.Save(specs))
+	assert.NoError(t, store.Save(specs[:1]))
+
+	loaded, err := ConstructJsonFileHostStore(filepath.Join(dir, "data", "hosts.json")).Load()
+	assert.NoError(t, err)
+	assert.Equal(t, specs[:1], loaded)
+
+	// the temporary files used for the atomic writes are gone
+	entries, _ := os.ReadDir(filepath.Join(dir, "data"))
+	assert.Len(t, entries, 1)
+}
+
+func TestConstructHostManager_StoredHosts_PoolRestored(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts.json")
+	mgr, err := ConstructHostManager(Helper_ConstructMockHttpClient(), Helper_ConstructHealthCheckConfig(), api.HostLeaseConfig{}, ConstructJsonFileHostStore(path))
+	assert.NoError(t, err)
+	mgr.ReplaceHosts([]api.HostSpec{{ID: "host-1", Address: "http://localhost:4001", Weight: 2}})
+	mgr.RegisterHost("http://localhost:4002")
+	mgr.DeregisterHost("http://localhost:4001")
+	mgr.RegisterHost("http://localhost:4003")
+	expected := mgr.GetHosts()
+
+	restored, err := ConstructHostManager(Helper_ConstructMockHttpClient(), Helper_ConstructHealthCheckConfig(), api.HostLeaseConfig{}, ConstructJsonFileHostStore(path))
+	assert.NoError(t, err)
+
+	hosts := restored.GetHosts()
+	assert.Len(t, hosts, 2)
+	for i := range hosts {
+		assert.Equal(t, expected[i].ID, hosts[i].ID)
+		assert.Equal(t, expected[i].Address, hosts[i].Address)
+		assert.Equal(t, expected[i].Weight, hosts[i].Weight)
+		assert.False(t, hosts[i].Healthy)
+	}
+}
+
+func TestConstructHostManager_StoredLeasedHost_LeaseRestarted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts.json")
+	mgr, _ := ConstructHostManager(Helper_ConstructMockHttpClient(), Helper_ConstructHealthCheckConfig(), api.HostLeaseConfig{}, ConstructJsonFileHostStore(path))
+	mgr.RegisterLeasedHost("http://localhost:4001", 1, 10)
+	mgr.RegisterHost("http://localhost:4002")
+
+	restored, err := ConstructHostManager(Helper_ConstructMockHttpClient(), Helper_ConstructHealthCheckConfig(), api.HostLeaseConfig{}, ConstructJsonFileHostStore(path))
+	assert.NoError(t, err)
+	clock := Helper_SetFakeClock(restored)
+
+	hosts := restored.GetHosts()
+	assert.Equal(t, 10, hosts[0].LeaseTtlSeconds)
+	assert.NotNil(t, hosts[0].LeaseExpiresAt)
+	assert.Nil(t, hosts[1].LeaseExpiresAt)
+
+	// a host which crashed along with the routing app doesn't stay registered
+	clock.Advance(11 * time.Second)
+	restored.sweepExpiredLeases()
+	hosts = restored.GetHosts()
+	assert.Len(t, hosts, 1)
+	assert.Equal(t, "http://localhost:4002", hosts[0].Address)
+}
+
+func TestConstructHostManager_InvalidStoredHosts_ReturnError(t *testing.T) {
+	store := &MockHostStore{}
+	store.On("Load").Return([]api.HostSpec{{Address: "http://localhost:4001"}, {Address: "http://localhost:4001"}}, nil)
+
+	_, err := ConstructHostManager(Helper_ConstructMockHttpClient(), Helper_ConstructHealthCheckConfig(), api.HostLeaseConfig{}, store)
+	assert.Error(t, err)
+}
+
+func TestRegisterHost_SaveFails_PoolUnchanged(t *testing.T) {
+	store := &MockHostStore{}
+	store.On("Load").Return([]api.HostSpec{{ID: "host-1", Address: "http://localhost:4001"}}, nil)
+	store.On("Save", mock.Anything).Return(errors.New("disk full"))
+
+	mgr, err := ConstructHostManager(Helper_ConstructMockHttpClient(), Helper_ConstructHealthCheckConfig(), api.HostLeaseConfig{}, store)
+	assert.NoError(t, err)
+
+	response := mgr.RegisterHost("http://localhost:4002")
+	assert.Error(t, response.Error)
+	response = mgr.DeregisterHost("http://localhost:4001")
+	assert.Error(t, response.Error)
+	weight := 3
+	response = mgr.UpdateHost("host-1", api.HostPatch{Weight: &weight})
+	assert.Error(t, response.Error)
+
+	hosts := mgr.GetHosts()
+	assert.Len(t, hosts, 1)
+	assert.Equal(t, "http://localhost:4001", hosts[0].Address)
+	assert.Equal(t, defaultHostWeight, hosts[0].Weight)
+}
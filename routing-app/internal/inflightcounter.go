@@ -0,0 +1,68 @@
+package internal
+
+import (
+	"io"
+	"net/http"
+	"sync"
+)
+
+func constructInFlightCounter() *inFlightCounter {
+	return &inFlightCounter{
+		counts: map[string]int{},
+	}
+}
+
+// inFlightCounter keeps the number of forwarding attempts currently awaiting a response, per host address.
+type inFlightCounter struct {
+	counts map[string]int
+	lock   sync.Mutex
+}
+
+// trackAttempt counts the attempt as in flight until its response body is closed, or until it failed
+// without a response.
+func (this *inFlightCounter) trackAttempt(host string) func(*http.Response, error) {
+	this.lock.Lock()
+	this.counts[host]++
+	this.lock.Unlock()
+
+	return func(resp *http.Response, err error) {
+		if err != nil || resp == nil || resp.Body == nil {
+			this.release(host)
+			return
+		}
+
+		resp.Body = &releaseOnCloseBody{ReadCloser: resp.Body, release: func() { this.release(host) }}
+	}
+}
+
+func (this *inFlightCounter) get(host string) int {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	return this.counts[host]
+}
+
+// Private Functions
+
+func (this *inFlightCounter) release(host string) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	this.counts[host]--
+	if this.counts[host] <= 0 {
+		delete(this.counts, host)
+	}
+}
+
+// releaseOnCloseBody releases the in flight attempt which produced the body once it's closed.
+type releaseOnCloseBody struct {
+	io.ReadCloser
+	release func()
+	once    sync.Once
+}
+
+func (this *releaseOnCloseBody) Close() error {
+	err := this.ReadCloser.Close()
+	this.once.Do(this.release)
+	return err
+}
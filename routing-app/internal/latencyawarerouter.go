@@ -0,0 +1,168 @@
+package internal
+
+import (
+	"andrewsaputra/routing-app/api"
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSmoothingFactor      = 0.3
+	defaultFailurePenaltyMillis = 5000
+)
+
+func ConstructLatencyAwareRouter(client *http.Client, hostManager *HostManager, requestHandling api.RequestHandlingConfig, config api.LatencyAwareConfig) *LatencyAwareRouter {
+	smoothingFactor := config.SmoothingFactor
+	if smoothingFactor <= 0 || smoothingFactor > 1 {
+		smoothingFactor = defaultSmoothingFactor
+	}
+
+	explorationPercent := config.ExplorationPercent
+	if explorationPercent < 0 {
+		explorationPercent = 0
+	} else if explorationPercent > 100 {
+		explorationPercent = 100
+	}
+
+	failurePenalty := time.Duration(config.FailurePenaltyMillis) * time.Millisecond
+	if failurePenalty <= 0 {
+		failurePenalty = defaultFailurePenaltyMillis * time.Millisecond
+	}
+
+	return &LatencyAwareRouter{
+		forwarder:          constructRequestForwarder(client, hostManager, requestHandling),
+		smoothingFactor:    smoothingFactor,
+		explorationPercent: explorationPercent,
+		failurePenalty:     failurePenalty,
+		latencies:          map[string]float64{},
+		random:             rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// LatencyAwareRouter prefers the host with the lowest exponentially weighted moving average of response
+// latency, while a small share of requests explores the other hosts so their averages stay up to date.
+type LatencyAwareRouter struct {
+	forwarder          *requestForwarder
+	smoothingFactor    float64
+	explorationPercent int
+	failurePenalty     time.Duration
+	latencies          map[string]float64
+	random             *rand.Rand
+	lock               sync.Mutex
+}
+
+func (this *LatencyAwareRouter) ForwardRequest(req *http.Request) (*http.Response, error) {
+	return this.forwarder.forward(req, this.selectHost, this)
+}
+
+func (this *LatencyAwareRouter) selectHost(hosts []api.Host, tried map[string]bool) string {
+	candidates := untriedHosts(hosts, tried)
+	lenCandidates := len(candidates)
+
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	this.pruneLatencies(hosts)
+
+	// hosts without any sample yet start at the pool mean, so they're reached through exploration
+	// rather than taking every request until their first response comes back
+	meanLatency := this.meanLatency(hosts)
+	estimate := func(host api.Host) float64 {
+		latency, ok := this.latencies[host.Address]
+		if !ok {
+			return meanLatency
+		}
+		return latency
+	}
+
+	fastest := 0
+	for i, host := range candidates {
+		if estimate(host) < estimate(candidates[fastest]) {
+			fastest = i
+		}
+	}
+
+	if lenCandidates > 1 && this.random.Intn(100) < this.explorationPercent {
+		other := this.random.Intn(lenCandidates - 1)
+		if other >= fastest {
+			other++
+		}
+		return candidates[other].Address
+	}
+
+	return candidates[fastest].Address
+}
+
+func (this *LatencyAwareRouter) trackAttempt(host string) func(*http.Response, error) {
+	startedAt := time.Now()
+	return func(resp *http.Response, err error) {
+		if errors.Is(err, context.Canceled) {
+			return
+		}
+
+		latency := time.Since(startedAt)
+		failed := err != nil || resp.StatusCode >= http.StatusInternalServerError
+		if failed && latency < this.failurePenalty {
+			latency = this.failurePenalty
+		}
+
+		this.recordLatency(host, latency)
+	}
+}
+
+func (this *LatencyAwareRouter) recordLatency(host string, latency time.Duration) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	sample := float64(latency) / float64(time.Millisecond)
+	current, ok := this.latencies[host]
+	if !ok {
+		this.latencies[host] = sample
+		return
+	}
+
+	this.latencies[host] = this.smoothingFactor*sample + (1-this.smoothingFactor)*current
+}
+
+// Private Functions
+
+// meanLatency returns the average latency of the sampled hosts, or 0 when none of them has samples.
+// Must be called while holding the lock.
+func (this *LatencyAwareRouter) meanLatency(hosts []api.Host) float64 {
+	total := 0.0
+	numSampled := 0
+	for _, host := range hosts {
+		if latency, ok := this.latencies[host.Address]; ok {
+			total += latency
+			numSampled++
+		}
+	}
+
+	if numSampled == 0 {
+		return 0
+	}
+	return total / float64(numSampled)
+}
+
+// pruneLatencies forgets the hosts which are no longer registered. Hosts which are only ineligible for now,
+// e.g. unhealthy ones, keep their average. Must be called while holding the lock.
+func (this *LatencyAwareRouter) pruneLatencies(hosts []api.Host) {
+	if len(this.latencies) == 0 {
+		return
+	}
+
+	eligible := make(map[string]bool, len(hosts))
+	for _, host := range hosts {
+		eligible[host.Address] = true
+	}
+
+	for address := range this.latencies {
+		if !eligible[address] && !this.forwarder.hostManager.hasHost(address) {
+			delete(this.latencies, address)
+		}
+	}
+}
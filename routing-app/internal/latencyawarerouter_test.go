@@ -0,0 +1,142 @@
+package internal
+
+import (
+	"andrewsaputra/routing-app/api"
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestNextTargetHost_DifferentLatencies_ReturnFastestHost(t *testing.T) {
+	router, hostManager := Helper_ConstructLatencyAwareRouter(0)
+	hostManager.RegisterHost("host1")
+	hostManager.RegisterHost("host2")
+	hostManager.RegisterHost("host3")
+
+	router.recordLatency("host1", 300*time.Millisecond)
+	router.recordLatency("host2", 50*time.Millisecond)
+	router.recordLatency("host3", 120*time.Millisecond)
+
+	for i := 0; i < 10; i++ {
+		target, err := router.forwarder.nextTargetHost(router.selectHost, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "host2", target)
+	}
+}
+
+func TestSelectHost_HostWithoutSamples_StartAtPoolMean(t *testing.T) {
+	router, hostManager := Helper_ConstructLatencyAwareRouter(0)
+	hostManager.RegisterHost("host1")
+	hostManager.RegisterHost("host2")
+	hostManager.RegisterHost("host3")
+
+	router.recordLatency("host1", 300*time.Millisecond)
+	router.recordLatency("host2", 100*time.Millisecond)
+
+	// host3 counts as 200ms, slower than host2 but faster than host1
+	hosts := hostManager.GetEligibleHosts()
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, "host2", router.selectHost(hosts, nil))
+		assert.Equal(t, "host3", router.selectHost(hosts, map[string]bool{"host2": true}))
+	}
+}
+
+func TestSelectHost_HostDeregistered_PruneLatency(t *testing.T) {
+	router, hostManager := Helper_ConstructLatencyAwareRouter(0)
+	hostManager.RegisterHost("host1")
+	hostManager.RegisterHost("host2")
+
+	router.recordLatency("host1", 10*time.Millisecond)
+	router.recordLatency("host2", 20*time.Millisecond)
+	hostManager.DeregisterHost("host1")
+
+	target, err := router.forwarder.nextTargetHost(router.selectHost, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "host2", target)
+	assert.NotContains(t, router.latencies, "host1")
+	assert.Contains(t, router.latencies, "host2")
+}
+
+func TestNextTargetHost_WithExploration_ReturnOtherHostsOccasionally(t *testing.T) {
+	router, hostManager := Helper_ConstructLatencyAwareRouter(20)
+	hostManager.RegisterHost("host1")
+	hostManager.RegisterHost("host2")
+
+	router.recordLatency("host1", 10*time.Millisecond)
+	router.recordLatency("host2", 500*time.Millisecond)
+
+	counts := map[string]int{}
+	for i := 0; i < 1000; i++ {
+		target, _ := router.forwarder.nextTargetHost(router.selectHost, nil)
+		counts[target]++
+	}
+
+	assert.Greater(t, counts["host1"], counts["host2"])
+	assert.Greater(t, counts["host2"], 100)
+	assert.Less(t, counts["host2"], 300)
+}
+
+func TestNextTargetHost_LatencyAwareNoEligibleHost_ReturnError(t *testing.T) {
+	router, _ := Helper_ConstructLatencyAwareRouter(0)
+	_, err := router.forwarder.nextTargetHost(router.selectHost, nil)
+	assert.Error(t, err)
+}
+
+func TestRecordLatency_MultipleSamples_ApplySmoothingFactor(t *testing.T) {
+	router, _ := Helper_ConstructLatencyAwareRouter(0)
+
+	router.recordLatency("host1", 100*time.Millisecond)
+	assert.InDelta(t, 100, router.latencies["host1"], 0.001)
+
+	router.recordLatency("host1", 200*time.Millisecond)
+	assert.InDelta(t, 150, router.latencies["host1"], 0.001)
+}
+
+func TestTrackAttempt_FailedAttempt_RecordFailurePenalty(t *testing.T) {
+	router, _ := Helper_ConstructLatencyAwareRouter(0)
+
+	router.trackAttempt("host1")(nil, errors.New("timeout"))
+	assert.InDelta(t, 1000, router.latencies["host1"], 1)
+
+	router.trackAttempt("host2")(&http.Response{StatusCode: http.StatusInternalServerError}, nil)
+	assert.InDelta(t, 1000, router.latencies["host2"], 1)
+
+	router.trackAttempt("host3")(&http.Response{StatusCode: http.StatusOK}, nil)
+	assert.Less(t, router.latencies["host3"], float64(1000))
+}
+
+func TestForwardRequest_HostReturnsServerError_DrainedFromSelection(t *testing.T) {
+	roundTripper := new(MockRoundTripper)
+	mock1 := roundTripper.On("RoundTrip", mock.Anything).
+		Return(&http.Response{StatusCode: http.StatusInternalServerError}, nil).
+		Once()
+	roundTripper.On("RoundTrip", mock.Anything).
+		Return(&http.Response{StatusCode: http.StatusOK}, nil).
+		NotBefore(mock1)
+	client := &http.Client{
+		Transport: roundTripper,
+	}
+
+	hostManager := Helper_ConstructHostManager()
+	hostManager.RegisterHost("http://host1")
+	hostManager.RegisterHost("http://host2")
+	router := ConstructLatencyAwareRouter(client, hostManager, api.RequestHandlingConfig{MaxRetries: 1}, api.LatencyAwareConfig{ExplorationPercent: 0})
+
+	body := io.NopCloser(bytes.NewReader([]byte(`{"key" : "value"}`)))
+	request, _ := http.NewRequest("POST", "/test", body)
+	request.Header.Set("Idempotency-Key", "a1b2c3")
+	resp, err := router.ForwardRequest(request)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	for i := 0; i < 5; i++ {
+		target, _ := router.forwarder.nextTargetHost(router.selectHost, nil)
+		assert.Equal(t, "http://host2", target)
+	}
+}
@@ -0,0 +1,54 @@
+package internal
+
+import (
+	"andrewsaputra/routing-app/api"
+	"net/http"
+	"sync"
+)
+
+func ConstructLeastConnectionsRouter(client *http.Client, hostManager *HostManager, requestHandling api.RequestHandlingConfig) *LeastConnectionsRouter {
+	return &LeastConnectionsRouter{
+		forwarder: constructRequestForwarder(client, hostManager, requestHandling),
+		inFlight:  constructInFlightCounter(),
+		tieIndex:  0,
+	}
+}
+
+type LeastConnectionsRouter struct {
+	forwarder *requestForwarder
+	inFlight  *inFlightCounter
+	tieIndex  int
+	lock      sync.Mutex
+}
+
+func (this *LeastConnectionsRouter) ForwardRequest(req *http.Request) (*http.Response, error) {
+	return this.forwarder.forward(req, this.selectHost, this.inFlight)
+}
+
+// selectHost returns the host with the fewest in-flight requests. The scan starts from a rotating offset
+// so that hosts with equal load still take turns instead of always favouring the first one.
+func (this *LeastConnectionsRouter) selectHost(hosts []api.Host, tried map[string]bool) string {
+	hosts = untriedHosts(hosts, tried)
+	lenHosts := len(hosts)
+
+	this.lock.Lock()
+	if this.tieIndex >= lenHosts {
+		this.tieIndex = 0
+	}
+	start := this.tieIndex
+	this.tieIndex++
+	this.lock.Unlock()
+
+	selected := ""
+	minCount := 0
+	for i := 0; i < lenHosts; i++ {
+		host := hosts[(start+i)%lenHosts]
+		count := this.inFlight.get(host.Address)
+		if selected == "" || count < minCount {
+			selected = host.Address
+			minCount = count
+		}
+	}
+
+	return selected
+}
@@ -0,0 +1,94 @@
+package internal
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNextTargetHost_HostWithInFlightRequests_ReturnLeastBusyHost(t *testing.T) {
+	router, hostManager := Helper_ConstructLeastConnectionsRouter()
+	hostManager.RegisterHost("host1")
+	hostManager.RegisterHost("host2")
+	hostManager.RegisterHost("host3")
+
+	router.inFlight.trackAttempt("host1")
+	router.inFlight.trackAttempt("host1")
+	router.inFlight.trackAttempt("host3")
+
+	for i := 0; i < 5; i++ {
+		target, err := router.forwarder.nextTargetHost(router.selectHost, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "host2", target)
+	}
+}
+
+func TestNextTargetHost_EqualInFlightRequests_ReturnWithRoundRobinAlgorithm(t *testing.T) {
+	router, hostManager := Helper_ConstructLeastConnectionsRouter()
+	hostAddresses := []string{"host1", "host2", "host3"}
+	for _, addr := range hostAddresses {
+		hostManager.RegisterHost(addr)
+	}
+
+	n := len(hostAddresses)
+	for i := 0; i < 3*n; i++ {
+		target, _ := router.forwarder.nextTargetHost(router.selectHost, nil)
+		assert.Equal(t, hostAddresses[i%n], target)
+	}
+}
+
+func TestNextTargetHost_LeastConnectionsNoEligibleHost_ReturnError(t *testing.T) {
+	router, _ := Helper_ConstructLeastConnectionsRouter()
+	_, err := router.forwarder.nextTargetHost(router.selectHost, nil)
+	assert.Error(t, err)
+}
+
+func TestForwardRequest_LeastConnectionsCompleted_ReleaseInFlightCount(t *testing.T) {
+	router, hostManager := Helper_ConstructLeastConnectionsRouter()
+	hostManager.RegisterHost("host1")
+
+	body := io.NopCloser(bytes.NewReader([]byte(`{"key" : "value"}`)))
+	request, _ := http.NewRequest("POST", "/test", body)
+	resp, err := router.ForwardRequest(request)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, router.inFlight.get("host1"))
+
+	resp.Body.Close()
+	assert.Equal(t, 0, router.inFlight.get("host1"))
+}
+
+func TestTrackAttempt_MultipleAttempts_CountInFlightPerHost(t *testing.T) {
+	counter := constructInFlightCounter()
+	done1 := counter.trackAttempt("host1")
+	done2 := counter.trackAttempt("host1")
+	counter.trackAttempt("host2")
+
+	assert.Equal(t, 2, counter.get("host1"))
+	assert.Equal(t, 1, counter.get("host2"))
+
+	done1(nil, nil)
+	assert.Equal(t, 1, counter.get("host1"))
+
+	done2(nil, nil)
+	assert.Equal(t, 0, counter.get("host1"))
+	assert.NotContains(t, counter.counts, "host1")
+}
+
+func TestTrackAttempt_ResponseReceived_ReleaseWhenBodyClosed(t *testing.T) {
+	counter := constructInFlightCounter()
+	resp := &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewReader([]byte("ok")))}
+	counter.trackAttempt("host1")(resp, nil)
+	assert.Equal(t, 1, counter.get("host1"))
+
+	resp.Body.Close()
+	assert.Equal(t, 0, counter.get("host1"))
+
+	resp.Body.Close()
+	assert.Equal(t, 0, counter.get("host1"))
+	assert.NotContains(t, counter.counts, "host1")
+}
@@ -0,0 +1,234 @@
+package internal
+
+import (
+	"andrewsaputra/routing-app/api"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultOutlierIntervalSeconds      = 10
+	defaultBaseEjectionSeconds         = 30
+	defaultMaxEjectionSeconds          = 300
+	defaultMaxEjectionPercent          = 50
+	defaultOutlierErrorRateMinRequests = 10
+)
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+func constructOutlierDetector(config api.OutlierDetectionConfig) *outlierDetector {
+	interval := config.IntervalSeconds
+	if interval <= 0 {
+		interval = defaultOutlierIntervalSeconds
+	}
+
+	baseEjection := config.BaseEjectionSeconds
+	if baseEjection <= 0 {
+		baseEjection = defaultBaseEjectionSeconds
+	}
+
+	maxEjection := config.MaxEjectionSeconds
+	if maxEjection <= 0 {
+		maxEjection = defaultMaxEjectionSeconds
+	}
+	if maxEjection < baseEjection {
+		maxEjection = baseEjection
+	}
+
+	maxEjectionPercent := config.MaxEjectionPercent
+	if maxEjectionPercent <= 0 {
+		maxEjectionPercent = defaultMaxEjectionPercent
+	}
+	if maxEjectionPercent > 100 {
+		maxEjectionPercent = 100
+	}
+
+	errorRateMinRequests := config.ErrorRateMinRequests
+	if errorRateMinRequests <= 0 {
+		errorRateMinRequests = defaultOutlierErrorRateMinRequests
+	}
+
+	return &outlierDetector{
+		consecutiveFailures:  config.ConsecutiveFailures,
+		consecutiveTimeouts:  config.ConsecutiveTimeouts,
+		errorRatePercent:     config.ErrorRatePercent,
+		errorRateMinRequests: errorRateMinRequests,
+		interval:             time.Duration(interval) * time.Second,
+		baseEjection:         time.Duration(baseEjection) * time.Second,
+		maxEjection:          time.Duration(maxEjection) * time.Second,
+		maxEjectionPercent:   maxEjectionPercent,
+		now:                  time.Now,
+	}
+}
+
+// outlierDetector ejects hosts based on the outcome of the requests forwarded to them, so a failing host
+// stops receiving traffic without waiting for the next health checks. An ejected host comes back half
+// open once its ejection period is over : a single probe request is let through, closing the circuit on
+// success or ejecting the host again for a longer period on failure. Each trigger is disabled when zero.
+type outlierDetector struct {
+	consecutiveFailures  int
+	consecutiveTimeouts  int
+	errorRatePercent     int
+	errorRateMinRequests int
+	interval             time.Duration
+	baseEjection         time.Duration
+	maxEjection          time.Duration
+	maxEjectionPercent   int
+	now                  func() time.Time
+}
+
+// circuitBreaker holds the forwarding outcomes of a single host. It has no lock of its own and must be
+// accessed while holding the stateLock of its host entry.
+type circuitBreaker struct {
+	state               circuitState
+	consecutiveFailures int
+	consecutiveTimeouts int
+	windowStart         time.Time
+	windowRequests      int
+	windowFailures      int
+	ejectionCount       int
+	ejectedUntil        time.Time
+	closedAt            time.Time
+	probing             bool
+}
+
+func (this *outlierDetector) enabled() bool {
+	return this.consecutiveFailures > 0 || this.consecutiveTimeouts > 0 || this.errorRatePercent > 0
+}
+
+// isAvailable tells whether the host may receive a request. Hosts whose ejection period is over are
+// available until their probe request starts.
+func (this *outlierDetector) isAvailable(breaker *circuitBreaker) bool {
+	switch breaker.state {
+	case circuitOpen:
+		return !this.now().Before(breaker.ejectedUntil)
+	case circuitHalfOpen:
+		return !breaker.probing
+	default:
+		return true
+	}
+}
+
+func (this *outlierDetector) attemptStarted(breaker *circuitBreaker) {
+	if breaker.state == circuitOpen && !this.now().Before(breaker.ejectedUntil) {
+		breaker.state = circuitHalfOpen
+	}
+
+	if breaker.state == circuitHalfOpen {
+		breaker.probing = true
+	}
+}
+
+// recordOutcome updates the breaker with the outcome of an attempt and tells whether the host should be
+// ejected. Outcomes of attempts which started before the host got ejected are ignored.
+func (this *outlierDetector) recordOutcome(breaker *circuitBreaker, resp *http.Response, err error) bool {
+	// cancelled attempts, like the losing copy of a hedged request, say nothing about the host
+	if errors.Is(err, context.Canceled) {
+		breaker.probing = false
+		return false
+	}
+
+	failed := err != nil || resp.StatusCode >= http.StatusInternalServerError
+	timedOut := isTimeout(err)
+
+	switch breaker.state {
+	case circuitOpen:
+		return false
+	case circuitHalfOpen:
+		if !breaker.probing {
+			return false
+		}
+		breaker.probing = false
+		if failed {
+			return true
+		}
+
+		*breaker = circuitBreaker{
+			state:         circuitClosed,
+			ejectionCount: breaker.ejectionCount,
+			closedAt:      this.now(),
+		}
+		return false
+	}
+
+	now := this.now()
+	if now.Sub(breaker.windowStart) >= this.interval {
+		breaker.windowStart = now
+		breaker.windowRequests = 0
+		breaker.windowFailures = 0
+	}
+
+	breaker.windowRequests++
+	if failed {
+		breaker.windowFailures++
+		breaker.consecutiveFailures++
+	} else {
+		breaker.consecutiveFailures = 0
+	}
+
+	if timedOut {
+		breaker.consecutiveTimeouts++
+	} else {
+		breaker.consecutiveTimeouts = 0
+	}
+
+	if this.consecutiveFailures > 0 && breaker.consecutiveFailures >= this.consecutiveFailures {
+		return true
+	}
+	if this.consecutiveTimeouts > 0 && breaker.consecutiveTimeouts >= this.consecutiveTimeouts {
+		return true
+	}
+	return this.errorRatePercent > 0 && breaker.windowRequests >= this.errorRateMinRequests &&
+		breaker.windowFailures*100 >= breaker.windowRequests*this.errorRatePercent
+}
+
+// canEject tells whether one more host may be ejected without exceeding maxEjectionPercent of the
+// numHosts registered hosts, numEjected of which are already ejected.
+func (this *outlierDetector) canEject(numEjected int, numHosts int) bool {
+	return (numEjected+1)*100 <= numHosts*this.maxEjectionPercent
+}
+
+// eject opens the circuit for baseEjection times the number of recent ejections, capped at maxEjection.
+// The multiplier starts over once the host has stayed closed for a full maxEjection period.
+func (this *outlierDetector) eject(breaker *circuitBreaker) time.Duration {
+	now := this.now()
+	ejectionCount := breaker.ejectionCount
+	if breaker.state == circuitClosed && ejectionCount > 0 && now.Sub(breaker.closedAt) >= this.maxEjection {
+		ejectionCount = 0
+	}
+	ejectionCount++
+
+	duration := this.baseEjection * time.Duration(ejectionCount)
+	if duration > this.maxEjection {
+		duration = this.maxEjection
+	}
+
+	*breaker = circuitBreaker{
+		state:         circuitOpen,
+		ejectionCount: ejectionCount,
+		ejectedUntil:  now.Add(duration),
+	}
+	return duration
+}
+
+func isTimeout(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,223 @@
+package internal
+
+import (
+	"andrewsaputra/routing-app/api"
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestOutlierDetector_ConsecutiveFailures_EjectHost(t *testing.T) {
+	hostManager, now := Helper_ConstructOutlierHostManager(api.OutlierDetectionConfig{ConsecutiveFailures: 3, MaxEjectionPercent: 50})
+	hostManager.RegisterHost("host1")
+	hostManager.RegisterHost("host2")
+
+	for i := 0; i < 2; i++ {
+		hostManager.trackAttempt("host1")(&http.Response{StatusCode: http.StatusBadGateway}, nil)
+	}
+	assert.Len(t, hostManager.GetEligibleHosts(), 2)
+
+	hostManager.trackAttempt("host1")(nil, errors.New("connection refused"))
+	hosts := hostManager.GetEligibleHosts()
+	assert.Len(t, hosts, 1)
+	assert.Equal(t, "host2", hosts[0].Address)
+
+	*now = now.Add(29 * time.Second)
+	assert.Len(t, hostManager.GetEligibleHosts(), 1)
+}
+
+func TestOutlierDetector_SuccessInBetween_ResetConsecutiveFailures(t *testing.T) {
+	hostManager, _ := Helper_ConstructOutlierHostManager(api.OutlierDetectionConfig{ConsecutiveFailures: 2, MaxEjectionPercent: 50})
+	hostManager.RegisterHost("host1")
+	hostManager.RegisterHost("host2")
+
+	for i := 0; i < 5; i++ {
+		hostManager.trackAttempt("host1")(&http.Response{StatusCode: http.StatusInternalServerError}, nil)
+		hostManager.trackAttempt("host1")(&http.Response{StatusCode: http.StatusOK}, nil)
+	}
+
+	assert.Len(t, hostManager.GetEligibleHosts(), 2)
+}
+
+func TestOutlierDetector_ConsecutiveTimeouts_EjectHost(t *testing.T) {
+	hostManager, _ := Helper_ConstructOutlierHostManager(api.OutlierDetectionConfig{ConsecutiveTimeouts: 2, MaxEjectionPercent: 50})
+	hostManager.RegisterHost("host1")
+	hostManager.RegisterHost("host2")
+
+	hostManager.trackAttempt("host1")(nil, context.DeadlineExceeded)
+	hostManager.trackAttempt("host1")(nil, context.DeadlineExceeded)
+
+	assert.Len(t, hostManager.GetEligibleHosts(), 1)
+}
+
+func TestOutlierDetector_ErrorRateExceeded_EjectHost(t *testing.T) {
+	hostManager, _ := Helper_ConstructOutlierHostManager(api.OutlierDetectionConfig{
+		ErrorRatePercent:     50,
+		ErrorRateMinRequests: 10,
+		MaxEjectionPercent:   50,
+	})
+	hostManager.RegisterHost("host1")
+	hostManager.RegisterHost("host2")
+
+	for i := 0; i < 4; i++ {
+		hostManager.trackAttempt("host1")(&http.Response{StatusCode: http.StatusOK}, nil)
+		hostManager.trackAttempt("host1")(&http.Response{StatusCode: http.StatusServiceUnavailable}, nil)
+	}
+	assert.Len(t, hostManager.GetEligibleHosts(), 2)
+
+	hostManager.trackAttempt("host1")(&http.Response{StatusCode: http.StatusOK}, nil)
+	hostManager.trackAttempt("host1")(&http.Response{StatusCode: http.StatusServiceUnavailable}, nil)
+	assert.Len(t, hostManager.GetEligibleHosts(), 1)
+}
+
+func TestOutlierDetector_MaxEjectionPercentReached_KeepHost(t *testing.T) {
+	hostManager, _ := Helper_ConstructOutlierHostManager(api.OutlierDetectionConfig{ConsecutiveFailures: 1, MaxEjectionPercent: 50})
+	for _, addr := range []string{"host1", "host2", "host3", "host4"} {
+		hostManager.RegisterHost(addr)
+	}
+
+	for _, addr := range []string{"host1", "host2", "host3"} {
+		hostManager.trackAttempt(addr)(nil, errors.New("connection refused"))
+	}
+
+	hosts := hostManager.GetEligibleHosts()
+	assert.Len(t, hosts, 2)
+	assert.Equal(t, "host3", hosts[0].Address)
+	assert.Equal(t, "host4", hosts[1].Address)
+}
+
+func TestOutlierDetector_EjectedHostClosedOrRemoved_FreeEjectionSlot(t *testing.T) {
+	hostManager, now := Helper_ConstructOutlierHostManager(api.OutlierDetectionConfig{ConsecutiveFailures: 1, MaxEjectionPercent: 50})
+	for _, addr := range []string{"host1", "host2", "host3", "host4"} {
+		hostManager.RegisterHost(addr)
+	}
+
+	hostManager.trackAttempt("host1")(nil, errors.New("connection refused"))
+	hostManager.trackAttempt("host2")(nil, errors.New("connection refused"))
+	assert.Len(t, hostManager.GetEligibleHosts(), 2)
+
+	// host1 recovers through its probe while host2 gets replaced
+	*now = now.Add(30 * time.Second)
+	hostManager.trackAttempt("host1")(&http.Response{StatusCode: http.StatusOK}, nil)
+	hostManager.DeregisterHost("host2")
+	hostManager.RegisterHost("host5")
+
+	hostManager.trackAttempt("host3")(nil, errors.New("connection refused"))
+	hostManager.trackAttempt("host4")(nil, errors.New("connection refused"))
+	hostManager.trackAttempt("host5")(nil, errors.New("connection refused"))
+
+	hosts := hostManager.GetEligibleHosts()
+	assert.Len(t, hosts, 2)
+	assert.Equal(t, "host1", hosts[0].Address)
+	assert.Equal(t, "host5", hosts[1].Address)
+}
+
+func TestOutlierDetector_HalfOpenProbe_SingleProbeThenClose(t *testing.T) {
+	hostManager, now := Helper_ConstructOutlierHostManager(api.OutlierDetectionConfig{ConsecutiveFailures: 1, MaxEjectionPercent: 50})
+	hostManager.RegisterHost("host1")
+	hostManager.RegisterHost("host2")
+
+	hostManager.trackAttempt("host1")(nil, errors.New("connection refused"))
+	*now = now.Add(30 * time.Second)
+	assert.Len(t, hostManager.GetEligibleHosts(), 2)
+
+	probeDone := hostManager.trackAttempt("host1")
+	assert.Len(t, hostManager.GetEligibleHosts(), 1)
+
+	probeDone(&http.Response{StatusCode: http.StatusOK}, nil)
+	assert.Len(t, hostManager.GetEligibleHosts(), 2)
+}
+
+func TestOutlierDetector_HalfOpenProbeFailed_EjectForLongerPeriod(t *testing.T) {
+	hostManager, now := Helper_ConstructOutlierHostManager(api.OutlierDetectionConfig{
+		ConsecutiveFailures: 1,
+		BaseEjectionSeconds: 30,
+		MaxEjectionSeconds:  45,
+		MaxEjectionPercent:  50,
+	})
+	hostManager.RegisterHost("host1")
+	hostManager.RegisterHost("host2")
+
+	hostManager.trackAttempt("host1")(nil, errors.New("connection refused"))
+	*now = now.Add(30 * time.Second)
+	hostManager.trackAttempt("host1")(nil, errors.New("connection refused"))
+
+	*now = now.Add(44 * time.Second)
+	assert.Len(t, hostManager.GetEligibleHosts(), 1)
+
+	*now = now.Add(time.Second)
+	assert.Len(t, hostManager.GetEligibleHosts(), 2)
+}
+
+func TestOutlierDetector_Disabled_NeverEject(t *testing.T) {
+	hostManager, _ := Helper_ConstructOutlierHostManager(api.OutlierDetectionConfig{MaxEjectionPercent: 100})
+	hostManager.RegisterHost("host1")
+
+	for i := 0; i < 100; i++ {
+		hostManager.trackAttempt("host1")(nil, errors.New("connection refused"))
+	}
+
+	assert.Len(t, hostManager.GetEligibleHosts(), 1)
+}
+
+func TestForwardRequest_HostEjected_StopForwardingToHost(t *testing.T) {
+	roundTripper := new(MockRoundTripper)
+	roundTripper.On("RoundTrip", mock.MatchedBy(func(req *http.Request) bool { return req.URL.Host == "host1" })).
+		Return(&http.Response{StatusCode: http.StatusInternalServerError, Body: http.NoBody}, nil)
+	roundTripper.On("RoundTrip", mock.MatchedBy(func(req *http.Request) bool { return req.URL.Host == "host2" })).
+		Return(&http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil)
+	client := &http.Client{
+		Transport: roundTripper,
+	}
+
+	hostManager, _ := Helper_ConstructOutlierHostManager(api.OutlierDetectionConfig{ConsecutiveFailures: 2, MaxEjectionPercent: 50})
+	hostManager.RegisterHost("http://host1")
+	hostManager.RegisterHost("http://host2")
+	router := ConstructRoundRobinRouter(client, hostManager, api.RequestHandlingConfig{MaxRetries: 0})
+
+	for i := 0; i < 10; i++ {
+		request, _ := http.NewRequest("GET", "/test", nil)
+		router.ForwardRequest(request)
+	}
+
+	roundTripper.AssertNumberOfCalls(t, "RoundTrip", 10)
+	assert.Equal(t, 2, Helper_CountCallsToHost(roundTripper, "host1"))
+}
+
+func Helper_ConstructOutlierHostManager(config api.OutlierDetectionConfig) (*HostManager, *time.Time) {
+	healthCheckConfig := Helper_ConstructHealthCheckConfig()
+	healthCheckConfig.OutlierDetection = config
+	hostManager, _ := ConstructHostManager(Helper_ConstructMockHttpClient(), healthCheckConfig, api.HostLeaseConfig{}, nil)
+
+	now := time.Unix(1000, 0)
+	hostManager.outlierDetector.now = func() time.Time { return now }
+	return hostManager, &now
+}
+
+func Helper_CountCallsToHost(roundTripper *MockRoundTripper, host string) int {
+	count := 0
+	for _, call := range roundTripper.Calls {
+		if call.Arguments.Get(0).(*http.Request).URL.Host == host {
+			count++
+		}
+	}
+	return count
+}
+
+func TestRetryAfter_AllHostsEjected_ReturnEarliestEjectionEnd(t *testing.T) {
+	hostManager, now := Helper_ConstructOutlierHostManager(api.OutlierDetectionConfig{ConsecutiveFailures: 1, MaxEjectionPercent: 100})
+	hostManager.RegisterHost("host1")
+	hostManager.RegisterHost("host2")
+
+	hostManager.trackAttempt("host1")(nil, errors.New("connection refused"))
+	*now = now.Add(10 * time.Second)
+	hostManager.trackAttempt("host2")(nil, errors.New("connection refused"))
+
+	assert.Empty(t, hostManager.GetEligibleHosts())
+	assert.Equal(t, 20*time.Second, hostManager.RetryAfter())
+}
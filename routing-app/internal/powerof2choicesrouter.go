@@ -0,0 +1,56 @@
+package internal
+
+import (
+	"andrewsaputra/routing-app/api"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+func ConstructPowerOfTwoChoicesRouter(client *http.Client, hostManager *HostManager, requestHandling api.RequestHandlingConfig) *PowerOfTwoChoicesRouter {
+	return &PowerOfTwoChoicesRouter{
+		forwarder: constructRequestForwarder(client, hostManager, requestHandling),
+		inFlight:  constructInFlightCounter(),
+		random:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+type PowerOfTwoChoicesRouter struct {
+	forwarder *requestForwarder
+	inFlight  *inFlightCounter
+	random    *rand.Rand
+	lock      sync.Mutex
+}
+
+func (this *PowerOfTwoChoicesRouter) ForwardRequest(req *http.Request) (*http.Response, error) {
+	return this.forwarder.forward(req, this.selectHost, this.inFlight)
+}
+
+// selectHost samples two distinct hosts at random and returns the one with fewer in-flight requests.
+// Compared to scanning every host, this avoids herding all concurrent requests onto the single least
+// loaded host.
+func (this *PowerOfTwoChoicesRouter) selectHost(hosts []api.Host, tried map[string]bool) string {
+	hosts = untriedHosts(hosts, tried)
+	lenHosts := len(hosts)
+	if lenHosts == 1 {
+		return hosts[0].Address
+	}
+
+	this.lock.Lock()
+	first := this.random.Intn(lenHosts)
+	second := this.random.Intn(lenHosts - 1)
+	this.lock.Unlock()
+
+	if second >= first {
+		second++
+	}
+
+	firstHost := hosts[first].Address
+	secondHost := hosts[second].Address
+	if this.inFlight.get(secondHost) < this.inFlight.get(firstHost) {
+		return secondHost
+	}
+
+	return firstHost
+}
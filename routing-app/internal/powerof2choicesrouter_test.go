@@ -0,0 +1,93 @@
+package internal
+
+import (
+	"andrewsaputra/routing-app/api"
+	"bytes"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestNextTargetHost_TwoHostsWithDifferentLoad_ReturnLessLoadedHost(t *testing.T) {
+	router, hostManager := Helper_ConstructPowerOfTwoChoicesRouter()
+	hostManager.RegisterHost("host1")
+	hostManager.RegisterHost("host2")
+
+	router.inFlight.trackAttempt("host2")
+
+	for i := 0; i < 10; i++ {
+		target, err := router.forwarder.nextTargetHost(router.selectHost, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "host1", target)
+	}
+}
+
+func TestNextTargetHost_MostLoadedHost_NeverSelected(t *testing.T) {
+	router, hostManager := Helper_ConstructPowerOfTwoChoicesRouter()
+	hostAddresses := []string{"host1", "host2", "host3", "host4"}
+	for _, addr := range hostAddresses {
+		hostManager.RegisterHost(addr)
+	}
+
+	router.inFlight.trackAttempt("host3")
+	router.inFlight.trackAttempt("host3")
+
+	selected := map[string]int{}
+	for i := 0; i < 200; i++ {
+		target, _ := router.forwarder.nextTargetHost(router.selectHost, nil)
+		selected[target]++
+	}
+
+	assert.Zero(t, selected["host3"])
+	assert.Len(t, selected, 3)
+}
+
+func TestNextTargetHost_P2CSingleHost_ReturnSameHost(t *testing.T) {
+	router, hostManager := Helper_ConstructPowerOfTwoChoicesRouter()
+	hostManager.RegisterHost("host1")
+
+	for i := 0; i < 10; i++ {
+		target, _ := router.forwarder.nextTargetHost(router.selectHost, nil)
+		assert.Equal(t, "host1", target)
+	}
+}
+
+func TestNextTargetHost_P2CNoEligibleHost_ReturnError(t *testing.T) {
+	router, _ := Helper_ConstructPowerOfTwoChoicesRouter()
+	_, err := router.forwarder.nextTargetHost(router.selectHost, nil)
+	assert.Error(t, err)
+}
+
+func TestForwardRequest_P2CWithRetryAttempt_ReturnStatusOkAfterRetry(t *testing.T) {
+	roundTripper := new(MockRoundTripper)
+	mock1 := roundTripper.On("RoundTrip", mock.Anything).
+		Return(&http.Response{StatusCode: http.StatusInternalServerError}, nil).
+		Times(2)
+	roundTripper.On("RoundTrip", mock.Anything).
+		Return(&http.Response{StatusCode: http.StatusOK}, nil).
+		NotBefore(mock1)
+	client := &http.Client{
+		Transport: roundTripper,
+	}
+
+	hostManager := Helper_ConstructHostManager()
+	hostManager.RegisterHost("host1")
+	hostManager.RegisterHost("host2")
+	router := ConstructPowerOfTwoChoicesRouter(client, hostManager, api.RequestHandlingConfig{MaxRetries: 2})
+
+	body := io.NopCloser(bytes.NewReader([]byte(`{"key" : "value"}`)))
+	request, _ := http.NewRequest("POST", "/test", body)
+	request.Header.Set("Idempotency-Key", "a1b2c3")
+	resp, err := router.ForwardRequest(request)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NoError(t, err)
+	roundTripper.AssertNumberOfCalls(t, "RoundTrip", 3)
+
+	resp.Body.Close()
+	assert.Equal(t, 0, router.inFlight.get("host1"))
+	assert.Equal(t, 0, router.inFlight.get("host2"))
+}
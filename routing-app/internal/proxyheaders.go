@@ -0,0 +1,78 @@
+package internal
+
+import (
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strings"
+)
+
+// hopByHopHeaders only apply to a single connection and must not be forwarded by proxies (RFC 9110 section 7.6.1).
+var hopByHopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// buildUpstreamUrl keeps the escaped path and query string of the incoming request.
+func buildUpstreamUrl(targetHost string, reqUrl *url.URL) string {
+	upstreamUrl := strings.TrimSuffix(targetHost, "/") + reqUrl.EscapedPath()
+	if reqUrl.RawQuery != "" {
+		upstreamUrl += "?" + reqUrl.RawQuery
+	}
+	return upstreamUrl
+}
+
+// cloneRequestHeader returns the headers to send upstream, leaving the incoming request untouched.
+func cloneRequestHeader(header http.Header) http.Header {
+	result := header.Clone()
+	if result == nil {
+		result = http.Header{}
+	}
+	removeHopByHopHeaders(result)
+
+	// trailers support is the only TE value that is meaningful end to end
+	if headerContainsToken(header, "Te", "trailers") {
+		result.Set("Te", "trailers")
+	}
+	return result
+}
+
+func removeHopByHopHeaders(header http.Header) {
+	for _, value := range header.Values("Connection") {
+		for _, field := range strings.Split(value, ",") {
+			if field = textproto.TrimString(field); field != "" {
+				header.Del(field)
+			}
+		}
+	}
+
+	for _, key := range hopByHopHeaders {
+		header.Del(key)
+	}
+}
+
+func copyHeader(dst http.Header, src http.Header) {
+	for key, values := range src {
+		for _, value := range values {
+			dst.Add(key, value)
+		}
+	}
+}
+
+func headerContainsToken(header http.Header, key string, token string) bool {
+	for _, value := range header.Values(key) {
+		for _, field := range strings.Split(value, ",") {
+			if strings.EqualFold(textproto.TrimString(field), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,46 @@
+package internal
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildUpstreamUrl_WithQueryAndEscapedPath_KeepBoth(t *testing.T) {
+	reqUrl, _ := url.Parse("/echo%2Fjson/a%20b?gamer=GYUTDTE&points=20&points=30")
+
+	upstreamUrl := buildUpstreamUrl("http://localhost:4001/", reqUrl)
+	assert.Equal(t, "http://localhost:4001/echo%2Fjson/a%20b?gamer=GYUTDTE&points=20&points=30", upstreamUrl)
+
+	reqUrl, _ = url.Parse("/echojson")
+	upstreamUrl = buildUpstreamUrl("http://localhost:4001", reqUrl)
+	assert.Equal(t, "http://localhost:4001/echojson", upstreamUrl)
+}
+
+func TestCloneRequestHeader_HopByHopHeaders_Removed(t *testing.T) {
+	header := http.Header{}
+	header.Set("Connection", "keep-alive, X-Session-Hop")
+	header.Set("Keep-Alive", "timeout=5")
+	header.Set("Upgrade", "websocket")
+	header.Set("Proxy-Authorization", "Basic abc")
+	header.Set("Te", "gzip, trailers")
+	header.Set("X-Session-Hop", "1")
+	header.Add("Accept", "application/json")
+	header.Add("Accept", "text/plain")
+
+	result := cloneRequestHeader(header)
+
+	for _, key := range []string{"Connection", "Keep-Alive", "Upgrade", "Proxy-Authorization", "X-Session-Hop"} {
+		assert.Empty(t, result.Get(key), key)
+	}
+	assert.Equal(t, "trailers", result.Get("Te"))
+	assert.Equal(t, []string{"application/json", "text/plain"}, result.Values("Accept"))
+	assert.Equal(t, "1", header.Get("X-Session-Hop"))
+}
+
+func TestCloneRequestHeader_NilHeader_ReturnEmptyHeader(t *testing.T) {
+	result := cloneRequestHeader(nil)
+	assert.NotNil(t, result)
+}
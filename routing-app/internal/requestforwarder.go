@@ -0,0 +1,464 @@
+package internal
+
+import (
+	"andrewsaputra/routing-app/api"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultRetryBufferBytes    = 1 << 20
+	routingAttemptsHeader      = "X-Routing-Attempts"
+	defaultClientTimeoutHeader = "X-Request-Timeout-Ms"
+)
+
+var (
+	errNoAvailableHosts = errors.New("no available hosts")
+	errForwardingFailed = errors.New("request forwarding failed. please try again after a while.")
+	errUpstreamTimeout  = errors.New("upstream host did not respond in time")
+)
+
+// ForwardingError is returned when a request couldn't be forwarded, along with the hosts attempted.
+type ForwardingError struct {
+	Err      error
+	Attempts []string
+}
+
+func (this *ForwardingError) Error() string {
+	return this.Err.Error()
+}
+
+func (this *ForwardingError) Unwrap() error {
+	return this.Err
+}
+
+func constructRequestForwarder(client *http.Client, hostManager *HostManager, requestHandling api.RequestHandlingConfig) *requestForwarder {
+	retryBufferBytes := requestHandling.RetryBufferBytes
+	if retryBufferBytes <= 0 {
+		retryBufferBytes = defaultRetryBufferBytes
+	}
+
+	clientTimeoutHeader := requestHandling.ClientTimeoutHeader
+	if clientTimeoutHeader == "" {
+		clientTimeoutHeader = defaultClientTimeoutHeader
+	}
+
+	// invalid entries are rejected by setupHandler before any router gets constructed
+	trustedProxies, _ := ParseTrustedProxies(requestHandling.TrustedProxies)
+
+	return &requestForwarder{
+		client:              client,
+		hostManager:         hostManager,
+		maxRetries:          requestHandling.MaxRetries,
+		retryBufferBytes:    retryBufferBytes,
+		trustedProxies:      trustedProxies,
+		retryPolicy:         constructRetryPolicy(requestHandling.RetryPolicy),
+		retryBudget:         constructRetryBudget(requestHandling.RetryPolicy.RetryBudget),
+		hedgingPolicy:       constructHedgingPolicy(requestHandling.HedgedRoutes),
+		totalTimeout:        time.Duration(requestHandling.TotalTimeoutSeconds) * time.Second,
+		clientTimeoutHeader: clientTimeoutHeader,
+		maxClientTimeout:    time.Duration(requestHandling.MaxClientTimeoutMillis) * time.Millisecond,
+	}
+}
+
+// requestForwarder holds the retry loop shared by every routing algorithm. Each router only decides
+// which host should receive the next attempt.
+type requestForwarder struct {
+	client              *http.Client
+	hostManager         *HostManager
+	maxRetries          int
+	retryBufferBytes    int64
+	trustedProxies      []*net.IPNet
+	retryPolicy         *retryPolicy
+	retryBudget         *retryBudget
+	hedgingPolicy       *hedgingPolicy
+	totalTimeout        time.Duration
+	clientTimeoutHeader string
+	maxClientTimeout    time.Duration
+}
+
+// attemptTracker is notified before every forwarding attempt. The returned function is called once the
+// attempt completes, either with the upstream response or with the transport error. The function may wrap
+// the response body to follow the attempt until the body is closed.
+type attemptTracker interface {
+	trackAttempt(host string) func(resp *http.Response, err error)
+}
+
+// hostSelector picks the target of the next attempt among the eligible hosts, which is never empty.
+// Hosts already attempted for the request are marked in tried and should be avoided when possible.
+type hostSelector func(hosts []api.Host, tried map[string]bool) string
+
+// forward sends the request to the hosts picked by selectHost, retrying failed attempts. Upstream requests
+// are bound to the incoming request's context, so they're cancelled once the client goes away or once the
+// request deadline passes. The context is released when the returned response body is closed.
+func (this *requestForwarder) forward(req *http.Request, selectHost hostSelector, tracker attemptTracker) (*http.Response, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if timeout := this.requestTimeout(req); timeout > 0 {
+		ctx, cancel = context.WithTimeout(req.Context(), timeout)
+	} else {
+		ctx, cancel = context.WithCancel(req.Context())
+	}
+
+	resp, err := this.forwardWithContext(ctx, req, selectHost, tracker)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	resp.Body = &cancelOnCloseBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+func (this *requestForwarder) forwardWithContext(ctx context.Context, req *http.Request, selectHost hostSelector, tracker attemptTracker) (*http.Response, error) {
+	hedgedRoute := this.hedgingPolicy.match(req.URL.Path)
+	maxAttempts := 1
+	if this.maxRetries > 0 || hedgedRoute != nil {
+		err := bufferRequestBody(req, this.retryBufferBytes)
+		if err != nil {
+			return nil, err
+		}
+
+		// bodies too large for the retry buffer are streamed, so they can only be sent once
+		if req.GetBody != nil {
+			maxAttempts += this.maxRetries
+		}
+	}
+
+	// hedging sends the request twice, which is only safe when it could have been retried as well
+	if req.GetBody == nil || !this.retryPolicy.isIdempotent(req) {
+		hedgedRoute = nil
+	}
+
+	this.retryBudget.recordRequest()
+
+	attempts := []string{}
+	tried := map[string]bool{}
+	numAttempts := 0
+	var lastErr error
+	for numAttempts < maxAttempts {
+		if numAttempts > 0 {
+			backoff := time.NewTimer(this.retryPolicy.backoffDelay(numAttempts))
+			select {
+			case <-backoff.C:
+			case <-ctx.Done():
+				backoff.Stop()
+				return nil, &ForwardingError{Err: ctx.Err(), Attempts: attempts}
+			}
+		}
+
+		targetHost, err := this.nextTargetHost(selectHost, tried)
+		if err != nil {
+			return nil, &ForwardingError{Err: err, Attempts: attempts}
+		}
+		attempts = append(attempts, targetHost)
+		tried[targetHost] = true
+
+		var resp *http.Response
+		if hedgedRoute != nil {
+			var hedgeHost string
+			resp, hedgeHost, err = this.sendHedged(ctx, req, targetHost, hedgedRoute, selectHost, tried, tracker)
+			if hedgeHost != "" {
+				attempts = append(attempts, hedgeHost)
+				tried[hedgeHost] = true
+			}
+		} else {
+			var newReq *http.Request
+			newReq, err = this.buildUpstreamRequest(ctx, req, targetHost)
+			if err == nil {
+				resp, err = this.send(newReq, targetHost, tracker)
+			}
+		}
+
+		if !this.retryPolicy.isFailure(resp, err) {
+			return withRoutingAttempts(resp, attempts), nil
+		}
+
+		if ctx.Err() != nil {
+			if err == nil {
+				resp.Body.Close()
+			}
+			return nil, &ForwardingError{Err: ctx.Err(), Attempts: attempts}
+		}
+
+		lastErr = err
+		numAttempts++
+		if numAttempts >= maxAttempts || !this.retryPolicy.canRetry(req, err) || !this.retryBudget.tryAcquireRetry() {
+			// the last upstream response is passed on as is, only transport errors turn into a gateway error
+			if err == nil {
+				return withRoutingAttempts(resp, attempts), nil
+			}
+			break
+		}
+
+		if err == nil {
+			resp.Body.Close()
+		}
+	}
+
+	if isTimeout(lastErr) {
+		return nil, &ForwardingError{Err: errUpstreamTimeout, Attempts: attempts}
+	}
+	return nil, &ForwardingError{Err: errForwardingFailed, Attempts: attempts}
+}
+
+// requestTimeout returns the deadline of the whole request across retries, or zero when unbounded. A
+// timeout asked by the client is honoured up to maxClientTimeout and never extends the total timeout.
+func (this *requestForwarder) requestTimeout(req *http.Request) time.Duration {
+	timeout := this.totalTimeout
+	if this.maxClientTimeout <= 0 {
+		return timeout
+	}
+
+	millis, err := strconv.Atoi(req.Header.Get(this.clientTimeoutHeader))
+	if err != nil || millis <= 0 {
+		return timeout
+	}
+
+	clientTimeout := time.Duration(millis) * time.Millisecond
+	if clientTimeout > this.maxClientTimeout {
+		clientTimeout = this.maxClientTimeout
+	}
+	if timeout > 0 && timeout < clientTimeout {
+		return timeout
+	}
+	return clientTimeout
+}
+
+func (this *requestForwarder) nextTargetHost(selectHost hostSelector, tried map[string]bool) (string, error) {
+	hosts := this.hostManager.GetEligibleHosts()
+	if len(hosts) == 0 {
+		return "", errNoAvailableHosts
+	}
+
+	return selectHost(hosts, tried), nil
+}
+
+func (this *requestForwarder) buildUpstreamRequest(ctx context.Context, req *http.Request, targetHost string) (*http.Request, error) {
+	url := buildUpstreamUrl(targetHost, req.URL)
+	body := req.Body
+	if req.GetBody != nil {
+		var err error
+		body, err = req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	newReq, err := http.NewRequestWithContext(ctx, req.Method, url, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if body != nil && body != http.NoBody {
+		newReq.ContentLength = req.ContentLength
+	}
+	newReq.Header = cloneRequestHeader(req.Header)
+	setForwardedHeaders(newReq.Header, req, this.trustedProxies)
+	return newReq, nil
+}
+
+// send forwards a single attempt, reporting its outcome to the tracker and to outlier detection.
+func (this *requestForwarder) send(newReq *http.Request, targetHost string, tracker attemptTracker) (*http.Response, error) {
+	fmt.Println("forwarding request to :", newReq.URL)
+	var attemptDone func(*http.Response, error)
+	if tracker != nil {
+		attemptDone = tracker.trackAttempt(targetHost)
+	}
+	outlierDone := this.hostManager.trackAttempt(targetHost)
+
+	resp, err := this.client.Do(newReq)
+	outlierDone(resp, err)
+	if attemptDone != nil {
+		attemptDone(resp, err)
+	}
+	return resp, err
+}
+
+// sendHedged forwards the request to targetHost and, when no response arrived within the route's hedging
+// delay, sends a copy to another eligible host. The first successful response wins and the other attempt
+// is cancelled. The returned hedge host is empty when no copy was sent.
+func (this *requestForwarder) sendHedged(ctx context.Context, req *http.Request, targetHost string, route *hedgedRoute, selectHost hostSelector, tried map[string]bool, tracker attemptTracker) (*http.Response, string, error) {
+	results := make(chan hedgedResult, 2)
+	cancels := []context.CancelFunc{}
+	launch := func(host string) bool {
+		attemptCtx, cancel := context.WithCancel(ctx)
+		newReq, err := this.buildUpstreamRequest(attemptCtx, req, host)
+		if err != nil {
+			cancel()
+			return false
+		}
+
+		index := len(cancels)
+		cancels = append(cancels, cancel)
+		go func() {
+			startedAt := time.Now()
+			resp, err := this.send(newReq, host, tracker)
+			if !this.retryPolicy.isFailure(resp, err) {
+				route.recordLatency(time.Since(startedAt))
+			}
+			results <- hedgedResult{resp: resp, err: err, index: index, cancel: cancel}
+		}()
+		return true
+	}
+
+	if !launch(targetHost) {
+		return nil, "", errForwardingFailed
+	}
+
+	timer := time.NewTimer(route.delay())
+	defer timer.Stop()
+
+	hedgeHost := ""
+	inFlight := 1
+	for {
+		select {
+		case <-timer.C:
+			host, err := this.nextTargetHost(selectHost, tried)
+			if err == nil && !tried[host] && launch(host) {
+				hedgeHost = host
+				inFlight++
+			}
+
+		case result := <-results:
+			inFlight--
+			if this.retryPolicy.isFailure(result.resp, result.err) && inFlight > 0 {
+				result.discard()
+				continue
+			}
+
+			for i, cancel := range cancels {
+				if i != result.index {
+					cancel()
+				}
+			}
+			if inFlight > 0 {
+				go drainHedgedResults(results, inFlight)
+			}
+			return result.withCancelOnClose(), hedgeHost, result.err
+		}
+	}
+}
+
+// withRoutingAttempts lists the hosts attempted for the request in the response headers.
+func withRoutingAttempts(resp *http.Response, attempts []string) *http.Response {
+	if resp.Header == nil {
+		resp.Header = http.Header{}
+	}
+	resp.Header.Set(routingAttemptsHeader, strings.Join(attempts, ", "))
+	return resp
+}
+
+// untriedHosts returns the hosts not attempted yet, or all of them once every host has been attempted.
+func untriedHosts(hosts []api.Host, tried map[string]bool) []api.Host {
+	if len(tried) == 0 {
+		return hosts
+	}
+
+	result := make([]api.Host, 0, len(hosts))
+	for _, host := range hosts {
+		if !tried[host.Address] {
+			result = append(result, host)
+		}
+	}
+
+	if len(result) == 0 {
+		return hosts
+	}
+	return result
+}
+
+// bufferRequestBody reads the request body into memory when it fits within limit bytes and sets
+// req.GetBody so the body can be replayed on retries. Larger bodies are left as a stream, with the
+// bytes read so far put back in front of it, and req.GetBody stays nil.
+func bufferRequestBody(req *http.Request, limit int64) error {
+	if req.GetBody != nil {
+		return nil
+	}
+
+	if req.Body == nil || req.Body == http.NoBody {
+		req.GetBody = func() (io.ReadCloser, error) {
+			return http.NoBody, nil
+		}
+		return nil
+	}
+
+	if req.ContentLength > limit {
+		return nil
+	}
+
+	buffered, err := io.ReadAll(io.LimitReader(req.Body, limit+1))
+	if err != nil {
+		return err
+	}
+
+	if int64(len(buffered)) > limit {
+		req.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(buffered), req.Body), req.Body}
+		return nil
+	}
+
+	req.Body.Close()
+	req.ContentLength = int64(len(buffered))
+	req.Body = io.NopCloser(bytes.NewReader(buffered))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(buffered)), nil
+	}
+	return nil
+}
+
+// hedgedResult is the outcome of one of the attempts sent by sendHedged, along with the function
+// cancelling the attempt's context.
+type hedgedResult struct {
+	resp   *http.Response
+	err    error
+	index  int
+	cancel context.CancelFunc
+}
+
+// withCancelOnClose returns the response with a body releasing the attempt's context once closed.
+func (this hedgedResult) withCancelOnClose() *http.Response {
+	if this.err != nil {
+		this.cancel()
+		return nil
+	}
+
+	this.resp.Body = &cancelOnCloseBody{ReadCloser: this.resp.Body, cancel: this.cancel}
+	return this.resp
+}
+
+func (this hedgedResult) discard() {
+	if this.err == nil {
+		this.resp.Body.Close()
+	}
+	this.cancel()
+}
+
+// cancelOnCloseBody cancels the context of the request which produced the body once it's closed.
+type cancelOnCloseBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (this *cancelOnCloseBody) Close() error {
+	err := this.ReadCloser.Close()
+	this.cancel()
+	return err
+}
+
+func drainHedgedResults(results chan hedgedResult, remaining int) {
+	for i := 0; i < remaining; i++ {
+		result := <-results
+		result.discard()
+	}
+}
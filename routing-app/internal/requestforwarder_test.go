@@ -0,0 +1,295 @@
+package internal
+
+import (
+	"andrewsaputra/routing-app/api"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestBufferRequestBody_WithinLimit_BodyReplayable(t *testing.T) {
+	payload := `{"key" : "value"}`
+	request, _ := http.NewRequest("POST", "/test", io.NopCloser(strings.NewReader(payload)))
+
+	err := bufferRequestBody(request, 1024)
+	assert.NoError(t, err)
+	assert.NotNil(t, request.GetBody)
+	assert.Equal(t, int64(len(payload)), request.ContentLength)
+
+	for i := 0; i < 2; i++ {
+		body, _ := request.GetBody()
+		content, _ := io.ReadAll(body)
+		assert.Equal(t, payload, string(content))
+	}
+}
+
+func TestBufferRequestBody_ExceedLimit_BodyStreamedIntact(t *testing.T) {
+	payload := strings.Repeat("a", 100)
+	request, _ := http.NewRequest("POST", "/test", io.NopCloser(strings.NewReader(payload)))
+
+	err := bufferRequestBody(request, 10)
+	assert.NoError(t, err)
+	assert.Nil(t, request.GetBody)
+
+	content, _ := io.ReadAll(request.Body)
+	assert.Equal(t, payload, string(content))
+}
+
+func TestBufferRequestBody_KnownLengthExceedLimit_BodyNotRead(t *testing.T) {
+	reader := strings.NewReader(strings.Repeat("a", 100))
+	request, _ := http.NewRequest("POST", "/test", io.NopCloser(reader))
+	request.ContentLength = 100
+
+	err := bufferRequestBody(request, 10)
+	assert.NoError(t, err)
+	assert.Nil(t, request.GetBody)
+	assert.Equal(t, 100, reader.Len())
+}
+
+func TestForwardRequest_BodyExceedRetryBuffer_ForwardOnceWithoutRetry(t *testing.T) {
+	roundTripper := new(MockRoundTripper)
+	roundTripper.On("RoundTrip", mock.Anything).
+		Return(&http.Response{StatusCode: http.StatusInternalServerError}, nil)
+	client := &http.Client{
+		Transport: roundTripper,
+	}
+
+	hostManager := Helper_ConstructHostManager()
+	hostManager.RegisterHost("http://host1")
+	hostManager.RegisterHost("http://host2")
+	router := ConstructRoundRobinRouter(client, hostManager, api.RequestHandlingConfig{MaxRetries: 2, RetryBufferBytes: 10})
+
+	payload := strings.Repeat("a", 100)
+	request, _ := http.NewRequest("POST", "/test", io.NopCloser(strings.NewReader(payload)))
+	resp, err := router.ForwardRequest(request)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	roundTripper.AssertNumberOfCalls(t, "RoundTrip", 1)
+
+	upstreamReq := roundTripper.Calls[0].Arguments.Get(0).(*http.Request)
+	content, _ := io.ReadAll(upstreamReq.Body)
+	assert.Equal(t, payload, string(content))
+}
+
+func TestForwardRequest_WithoutRetries_BodyNotBuffered(t *testing.T) {
+	router, hostManager := Helper_ConstructRoundRobinRouter()
+	hostManager.RegisterHost("http://host1")
+
+	body := io.NopCloser(bytes.NewReader([]byte(`{"key" : "value"}`)))
+	request, _ := http.NewRequest("POST", "/test", body)
+	resp, err := router.ForwardRequest(request)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Nil(t, request.GetBody)
+}
+
+func TestForwardRequest_HostFailed_RetryOnDifferentHost(t *testing.T) {
+	roundTripper := new(MockRoundTripper)
+	roundTripper.On("RoundTrip", mock.MatchedBy(func(req *http.Request) bool { return req.URL.Host == "host1" })).
+		Return(&http.Response{StatusCode: http.StatusBadGateway, Body: http.NoBody}, nil)
+	roundTripper.On("RoundTrip", mock.MatchedBy(func(req *http.Request) bool { return req.URL.Host == "host2" })).
+		Return(&http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil)
+	client := &http.Client{
+		Transport: roundTripper,
+	}
+
+	hostManager := Helper_ConstructHostManager()
+	hostManager.RegisterHost("http://host1")
+	hostManager.RegisterHost("http://host2")
+	router := ConstructLeastConnectionsRouter(client, hostManager, api.RequestHandlingConfig{MaxRetries: 3})
+
+	request, _ := http.NewRequest("GET", "/test", nil)
+	resp, err := router.ForwardRequest(request)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "http://host1, http://host2", resp.Header.Get(routingAttemptsHeader))
+	roundTripper.AssertNumberOfCalls(t, "RoundTrip", 2)
+}
+
+func TestForwardRequest_AllAttemptsReturnServerError_ReturnLastUpstreamResponse(t *testing.T) {
+	roundTripper := new(MockRoundTripper)
+	roundTripper.On("RoundTrip", mock.Anything).
+		Return(&http.Response{StatusCode: http.StatusServiceUnavailable, Body: http.NoBody}, nil)
+	client := &http.Client{
+		Transport: roundTripper,
+	}
+
+	hostManager := Helper_ConstructHostManager()
+	hostManager.RegisterHost("http://host1")
+	hostManager.RegisterHost("http://host2")
+	router := ConstructRoundRobinRouter(client, hostManager, api.RequestHandlingConfig{MaxRetries: 1})
+
+	request, _ := http.NewRequest("GET", "/test", nil)
+	resp, err := router.ForwardRequest(request)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, "http://host1, http://host2", resp.Header.Get(routingAttemptsHeader))
+	roundTripper.AssertNumberOfCalls(t, "RoundTrip", 2)
+}
+
+func TestForwardRequest_AllAttemptsFailed_ReturnAttemptedHosts(t *testing.T) {
+	roundTripper := new(MockRoundTripper)
+	roundTripper.On("RoundTrip", mock.Anything).
+		Return((*http.Response)(nil), errors.New("connection reset by peer"))
+	client := &http.Client{
+		Transport: roundTripper,
+	}
+
+	hostManager := Helper_ConstructHostManager()
+	hostManager.RegisterHost("http://host1")
+	hostManager.RegisterHost("http://host2")
+	router := ConstructRoundRobinRouter(client, hostManager, api.RequestHandlingConfig{MaxRetries: 1})
+
+	request, _ := http.NewRequest("GET", "/test", nil)
+	resp, err := router.ForwardRequest(request)
+
+	assert.Nil(t, resp)
+	var forwardingErr *ForwardingError
+	if assert.ErrorAs(t, err, &forwardingErr) {
+		assert.ElementsMatch(t, []string{"http://host1", "http://host2"}, forwardingErr.Attempts)
+	}
+}
+
+func TestUntriedHosts_SomeTried_ReturnRemaining(t *testing.T) {
+	hosts := []api.Host{{Address: "host1"}, {Address: "host2"}, {Address: "host3"}}
+
+	assert.Equal(t, hosts, untriedHosts(hosts, nil))
+	assert.Equal(t, []api.Host{{Address: "host2"}}, untriedHosts(hosts, map[string]bool{"host1": true, "host3": true}))
+	assert.Equal(t, hosts, untriedHosts(hosts, map[string]bool{"host1": true, "host2": true, "host3": true}))
+}
+
+func TestForwardRequest_ClientCancelled_UpstreamCancelledWithoutRetry(t *testing.T) {
+	roundTripper := &DelayingRoundTripper{delays: map[string]time.Duration{"host1": 5 * time.Second, "host2": 5 * time.Second}}
+	client := &http.Client{
+		Transport: roundTripper,
+	}
+
+	hostManager := Helper_ConstructHostManager()
+	hostManager.RegisterHost("http://host1")
+	hostManager.RegisterHost("http://host2")
+	router := ConstructRoundRobinRouter(client, hostManager, api.RequestHandlingConfig{MaxRetries: 2})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	request, _ := http.NewRequestWithContext(ctx, "GET", "/test", nil)
+	resp, err := router.ForwardRequest(request)
+
+	assert.Nil(t, resp)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, roundTripper.getCalls())
+	assert.Equal(t, 1, roundTripper.getCancelled())
+}
+
+func TestForwardRequest_ClientTimeoutHeader_DeadlineAcrossRetries(t *testing.T) {
+	roundTripper := new(MockRoundTripper)
+	roundTripper.On("RoundTrip", mock.Anything).
+		Return(&http.Response{StatusCode: http.StatusServiceUnavailable, Body: http.NoBody}, nil)
+	client := &http.Client{
+		Transport: roundTripper,
+	}
+
+	hostManager := Helper_ConstructHostManager()
+	hostManager.RegisterHost("http://host1")
+	router := ConstructRoundRobinRouter(client, hostManager, api.RequestHandlingConfig{
+		MaxRetries:             5,
+		MaxClientTimeoutMillis: 1000,
+		RetryPolicy:            api.RetryPolicyConfig{BackoffBaseMillis: 5000, BackoffMaxMillis: 5000},
+	})
+
+	request, _ := http.NewRequest("GET", "/test", nil)
+	request.Header.Set(defaultClientTimeoutHeader, "100")
+	startedAt := time.Now()
+	resp, err := router.ForwardRequest(request)
+
+	assert.Nil(t, resp)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(startedAt), time.Second)
+}
+
+func TestForwardRequest_ResponseBodyOpen_ContextKeptUntilClose(t *testing.T) {
+	roundTripper := &ContextCapturingRoundTripper{}
+	client := &http.Client{
+		Transport: roundTripper,
+	}
+
+	hostManager := Helper_ConstructHostManager()
+	hostManager.RegisterHost("http://host1")
+	router := ConstructRoundRobinRouter(client, hostManager, api.RequestHandlingConfig{TotalTimeoutSeconds: 10})
+
+	request, _ := http.NewRequest("GET", "/test", nil)
+	resp, err := router.ForwardRequest(request)
+
+	assert.NoError(t, err)
+	assert.NoError(t, roundTripper.ctx.Err())
+	resp.Body.Close()
+	assert.Error(t, roundTripper.ctx.Err())
+}
+
+func TestRequestTimeout_ClientTimeoutHeader_CappedByConfig(t *testing.T) {
+	hostManager := Helper_ConstructHostManager()
+	forwarder := constructRequestForwarder(Helper_ConstructMockHttpClient(), hostManager, api.RequestHandlingConfig{
+		TotalTimeoutSeconds:    2,
+		ClientTimeoutHeader:    "X-Timeout",
+		MaxClientTimeoutMillis: 1500,
+	})
+
+	request, _ := http.NewRequest("GET", "/test", nil)
+	assert.Equal(t, 2*time.Second, forwarder.requestTimeout(request))
+
+	request.Header.Set("X-Timeout", "500")
+	assert.Equal(t, 500*time.Millisecond, forwarder.requestTimeout(request))
+
+	request.Header.Set("X-Timeout", "60000")
+	assert.Equal(t, 1500*time.Millisecond, forwarder.requestTimeout(request))
+
+	request.Header.Set("X-Timeout", "soon")
+	assert.Equal(t, 2*time.Second, forwarder.requestTimeout(request))
+}
+
+func TestRequestTimeout_MaxClientTimeoutUnset_HeaderIgnored(t *testing.T) {
+	hostManager := Helper_ConstructHostManager()
+	forwarder := constructRequestForwarder(Helper_ConstructMockHttpClient(), hostManager, api.RequestHandlingConfig{})
+
+	request, _ := http.NewRequest("GET", "/test", nil)
+	request.Header.Set(defaultClientTimeoutHeader, "500")
+	assert.Equal(t, time.Duration(0), forwarder.requestTimeout(request))
+}
+
+func TestForwardRequest_UpstreamTimedOut_ReturnUpstreamTimeout(t *testing.T) {
+	roundTripper := new(MockRoundTripper)
+	roundTripper.On("RoundTrip", mock.Anything).Return((*http.Response)(nil), context.DeadlineExceeded)
+	client := &http.Client{
+		Transport: roundTripper,
+	}
+
+	hostManager := Helper_ConstructHostManager()
+	hostManager.RegisterHost("http://host1")
+	router := ConstructRoundRobinRouter(client, hostManager, api.RequestHandlingConfig{MaxRetries: 0})
+
+	request, _ := http.NewRequest("GET", "/test", nil)
+	_, err := router.ForwardRequest(request)
+
+	assert.ErrorIs(t, err, errUpstreamTimeout)
+}
+
+// ContextCapturingRoundTripper keeps the context of the last request it received.
+type ContextCapturingRoundTripper struct {
+	ctx context.Context
+}
+
+func (this *ContextCapturingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	this.ctx = req.Context()
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+}
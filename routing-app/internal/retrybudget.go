@@ -0,0 +1,94 @@
+package internal
+
+import (
+	"andrewsaputra/routing-app/api"
+	"sync"
+	"time"
+)
+
+const defaultRetryBudgetWindowSeconds = 10
+
+func constructRetryBudget(config api.RetryBudgetConfig) *retryBudget {
+	windowSeconds := config.WindowSeconds
+	if windowSeconds <= 0 {
+		windowSeconds = defaultRetryBudgetWindowSeconds
+	}
+
+	return &retryBudget{
+		percent:             config.Percent,
+		minRetriesPerSecond: config.MinRetriesPerSecond,
+		buckets:             make([]retryBudgetBucket, windowSeconds),
+		now:                 time.Now,
+	}
+}
+
+// retryBudget caps retries to a percentage of the requests seen over a sliding window, so that retries
+// can't multiply the load on hosts during a fleet wide outage. A small number of retries per second is
+// always allowed so low traffic periods can still retry. A zero percent budget disables the limit.
+type retryBudget struct {
+	percent             int
+	minRetriesPerSecond int
+	buckets             []retryBudgetBucket
+	now                 func() time.Time
+	lock                sync.Mutex
+}
+
+// retryBudgetBucket holds the counters of a single second of the window.
+type retryBudgetBucket struct {
+	second   int64
+	requests int
+	retries  int
+}
+
+func (this *retryBudget) recordRequest() {
+	if this.percent <= 0 {
+		return
+	}
+
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	this.currentBucket().requests++
+}
+
+func (this *retryBudget) tryAcquireRetry() bool {
+	if this.percent <= 0 {
+		return true
+	}
+
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	bucket := this.currentBucket()
+	requests, retries := this.windowTotals()
+	allowed := requests*this.percent/100 + this.minRetriesPerSecond*len(this.buckets)
+	if retries >= allowed {
+		return false
+	}
+
+	bucket.retries++
+	return true
+}
+
+// currentBucket returns the bucket of the current second, clearing it first when it still holds
+// counters from a previous window.
+func (this *retryBudget) currentBucket() *retryBudgetBucket {
+	second := this.now().Unix()
+	bucket := &this.buckets[second%int64(len(this.buckets))]
+	if bucket.second != second {
+		*bucket = retryBudgetBucket{second: second}
+	}
+	return bucket
+}
+
+func (this *retryBudget) windowTotals() (int, int) {
+	oldest := this.now().Unix() - int64(len(this.buckets)) + 1
+	requests, retries := 0, 0
+	for _, bucket := range this.buckets {
+		if bucket.second >= oldest {
+			requests += bucket.requests
+			retries += bucket.retries
+		}
+	}
+	return requests, retries
+}
@@ -0,0 +1,128 @@
+package internal
+
+import (
+	"andrewsaputra/routing-app/api"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestRetryBudget_RetriesWithinPercent_Allowed(t *testing.T) {
+	budget := constructRetryBudget(api.RetryBudgetConfig{Percent: 20, WindowSeconds: 10})
+	now := time.Unix(1000, 0)
+	budget.now = func() time.Time { return now }
+
+	for i := 0; i < 100; i++ {
+		budget.recordRequest()
+	}
+
+	for i := 0; i < 20; i++ {
+		assert.True(t, budget.tryAcquireRetry())
+	}
+	assert.False(t, budget.tryAcquireRetry())
+}
+
+func TestRetryBudget_MinRetriesPerSecond_AllowedWithoutTraffic(t *testing.T) {
+	budget := constructRetryBudget(api.RetryBudgetConfig{Percent: 20, MinRetriesPerSecond: 1, WindowSeconds: 5})
+	now := time.Unix(1000, 0)
+	budget.now = func() time.Time { return now }
+
+	for i := 0; i < 5; i++ {
+		assert.True(t, budget.tryAcquireRetry())
+	}
+	assert.False(t, budget.tryAcquireRetry())
+}
+
+func TestRetryBudget_WindowSlides_OldCountersExpire(t *testing.T) {
+	budget := constructRetryBudget(api.RetryBudgetConfig{Percent: 50, WindowSeconds: 3})
+	now := time.Unix(1000, 0)
+	budget.now = func() time.Time { return now }
+
+	budget.recordRequest()
+	budget.recordRequest()
+	assert.True(t, budget.tryAcquireRetry())
+	assert.False(t, budget.tryAcquireRetry())
+
+	now = now.Add(3 * time.Second)
+	assert.False(t, budget.tryAcquireRetry())
+
+	budget.recordRequest()
+	budget.recordRequest()
+	assert.True(t, budget.tryAcquireRetry())
+}
+
+func TestRetryBudget_ZeroPercent_Unlimited(t *testing.T) {
+	budget := constructRetryBudget(api.RetryBudgetConfig{})
+	for i := 0; i < 100; i++ {
+		assert.True(t, budget.tryAcquireRetry())
+	}
+}
+
+func TestBackoffDelay_ExponentialWithJitter_WithinCeiling(t *testing.T) {
+	policy := constructRetryPolicy(api.RetryPolicyConfig{BackoffBaseMillis: 100, BackoffMaxMillis: 500})
+
+	ceilings := []time.Duration{100, 200, 400, 500, 500}
+	for i, ceiling := range ceilings {
+		maxSeen := time.Duration(0)
+		for j := 0; j < 200; j++ {
+			delay := policy.backoffDelay(i + 1)
+			assert.GreaterOrEqual(t, delay, time.Duration(0))
+			assert.LessOrEqual(t, delay, ceiling*time.Millisecond)
+			if delay > maxSeen {
+				maxSeen = delay
+			}
+		}
+		assert.Greater(t, maxSeen, ceiling*time.Millisecond/2)
+	}
+
+	assert.LessOrEqual(t, policy.backoffDelay(100), 500*time.Millisecond)
+}
+
+func TestBackoffDelay_LargeBaseLateRetry_CappedAtMax(t *testing.T) {
+	policy := constructRetryPolicy(api.RetryPolicyConfig{BackoffBaseMillis: 8600, BackoffMaxMillis: 10000})
+
+	// base * 2^30 overflows int64
+	for retry := 1; retry <= 70; retry++ {
+		delay := policy.backoffDelay(retry)
+		assert.GreaterOrEqual(t, delay, time.Duration(0), retry)
+		assert.LessOrEqual(t, delay, 10000*time.Millisecond, retry)
+	}
+}
+
+func TestBackoffDelay_NoBase_NoDelay(t *testing.T) {
+	policy := constructRetryPolicy(api.RetryPolicyConfig{})
+	assert.Equal(t, time.Duration(0), policy.backoffDelay(3))
+}
+
+func TestForwardRequest_RetryBudgetExhausted_StopRetrying(t *testing.T) {
+	roundTripper := new(MockRoundTripper)
+	roundTripper.On("RoundTrip", mock.Anything).
+		Return(&http.Response{StatusCode: http.StatusServiceUnavailable}, nil)
+	client := &http.Client{
+		Transport: roundTripper,
+	}
+
+	hostManager := Helper_ConstructHostManager()
+	hostManager.RegisterHost("http://host1")
+	hostManager.RegisterHost("http://host2")
+	router := ConstructRoundRobinRouter(client, hostManager, api.RequestHandlingConfig{
+		MaxRetries: 2,
+		RetryPolicy: api.RetryPolicyConfig{
+			RetryBudget: api.RetryBudgetConfig{Percent: 50, WindowSeconds: 60},
+		},
+	})
+
+	numRequests := 10
+	for i := 0; i < numRequests; i++ {
+		request, _ := http.NewRequest("GET", "/test", nil)
+		resp, err := router.ForwardRequest(request)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	}
+
+	// without the budget every request would have been attempted 3 times
+	roundTripper.AssertNumberOfCalls(t, "RoundTrip", numRequests+numRequests/2)
+}
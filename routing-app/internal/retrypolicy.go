@@ -0,0 +1,125 @@
+package internal
+
+import (
+	"andrewsaputra/routing-app/api"
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultIdempotencyKeyHeader = "Idempotency-Key"
+	defaultBackoffMaxMillis     = 1000
+)
+
+var (
+	defaultRetryableMethods     = []string{http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete}
+	defaultRetryableStatusCodes = []int{http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+)
+
+func constructRetryPolicy(config api.RetryPolicyConfig) *retryPolicy {
+	methods := config.RetryableMethods
+	if len(methods) == 0 {
+		methods = defaultRetryableMethods
+	}
+
+	statusCodes := config.RetryableStatusCodes
+	if len(statusCodes) == 0 {
+		statusCodes = defaultRetryableStatusCodes
+	}
+
+	idempotencyKeyHeader := config.IdempotencyKeyHeader
+	if idempotencyKeyHeader == "" {
+		idempotencyKeyHeader = defaultIdempotencyKeyHeader
+	}
+
+	backoffMax := time.Duration(config.BackoffMaxMillis) * time.Millisecond
+	if backoffMax <= 0 {
+		backoffMax = defaultBackoffMaxMillis * time.Millisecond
+	}
+
+	policy := &retryPolicy{
+		retryableMethods:     map[string]bool{},
+		retryableStatusCodes: map[int]bool{},
+		idempotencyKeyHeader: idempotencyKeyHeader,
+		backoffBase:          time.Duration(config.BackoffBaseMillis) * time.Millisecond,
+		backoffMax:           backoffMax,
+		random:               rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	for _, method := range methods {
+		policy.retryableMethods[strings.ToUpper(method)] = true
+	}
+	for _, statusCode := range statusCodes {
+		policy.retryableStatusCodes[statusCode] = true
+	}
+
+	return policy
+}
+
+// retryPolicy decides whether a failed attempt may be sent again. A request that never reached the host
+// can always be retried, while a request that may already have been processed upstream is only retried
+// when repeating it is safe : idempotent methods, or requests carrying an idempotency key.
+type retryPolicy struct {
+	retryableMethods     map[string]bool
+	retryableStatusCodes map[int]bool
+	idempotencyKeyHeader string
+	backoffBase          time.Duration
+	backoffMax           time.Duration
+	random               *rand.Rand
+	lock                 sync.Mutex
+}
+
+func (this *retryPolicy) isFailure(resp *http.Response, err error) bool {
+	return err != nil || this.retryableStatusCodes[resp.StatusCode]
+}
+
+func (this *retryPolicy) canRetry(req *http.Request, err error) bool {
+	if err != nil && !isRequestSent(err) {
+		return true
+	}
+
+	return this.isIdempotent(req)
+}
+
+func (this *retryPolicy) isIdempotent(req *http.Request) bool {
+	return this.retryableMethods[req.Method] || req.Header.Get(this.idempotencyKeyHeader) != ""
+}
+
+// backoffDelay returns the wait before the given retry (starting from 1) using exponential backoff with
+// full jitter : a random duration between zero and base * 2^(retry-1), capped by the max backoff.
+func (this *retryPolicy) backoffDelay(retry int) time.Duration {
+	if this.backoffBase <= 0 {
+		return 0
+	}
+
+	// comparing against the max shifted right keeps base * 2^(retry-1) from overflowing on late retries
+	ceiling := this.backoffMax
+	if this.backoffBase <= this.backoffMax>>(retry-1) {
+		ceiling = this.backoffBase << (retry - 1)
+	}
+
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	return time.Duration(this.random.Int63n(int64(ceiling) + 1))
+}
+
+// isRequestSent reports whether the request may have reached the host. Failures while resolving or
+// connecting (e.g. connection refused) happen before anything is written.
+func isRequestSent(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return false
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return false
+	}
+
+	return true
+}
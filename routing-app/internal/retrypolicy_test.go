@@ -0,0 +1,115 @@
+package internal
+
+import (
+	"andrewsaputra/routing-app/api"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestRetryPolicy_DefaultConfig_RetryIdempotentMethodsOnly(t *testing.T) {
+	policy := constructRetryPolicy(api.RetryPolicyConfig{})
+	sentErr := errors.New("read: connection reset by peer")
+
+	for _, method := range []string{"GET", "HEAD", "OPTIONS", "TRACE", "PUT", "DELETE"} {
+		request, _ := http.NewRequest(method, "/test", nil)
+		assert.True(t, policy.canRetry(request, sentErr), method)
+		assert.True(t, policy.canRetry(request, nil), method)
+	}
+
+	for _, method := range []string{"POST", "PATCH"} {
+		request, _ := http.NewRequest(method, "/test", nil)
+		assert.False(t, policy.canRetry(request, sentErr), method)
+		assert.False(t, policy.canRetry(request, nil), method)
+	}
+}
+
+func TestRetryPolicy_PostWithIdempotencyKey_AllowRetry(t *testing.T) {
+	policy := constructRetryPolicy(api.RetryPolicyConfig{})
+	request, _ := http.NewRequest("POST", "/test", nil)
+	request.Header.Set("Idempotency-Key", "a1b2c3")
+
+	assert.True(t, policy.canRetry(request, nil))
+
+	policy = constructRetryPolicy(api.RetryPolicyConfig{IdempotencyKeyHeader: "X-Request-Key"})
+	assert.False(t, policy.canRetry(request, nil))
+}
+
+func TestRetryPolicy_ConnectionRefusedBeforeSend_AlwaysRetry(t *testing.T) {
+	policy := constructRetryPolicy(api.RetryPolicyConfig{})
+	request, _ := http.NewRequest("POST", "/test", nil)
+
+	dialErr := &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+	assert.True(t, policy.canRetry(request, dialErr))
+	assert.True(t, policy.canRetry(request, &net.DNSError{Err: "no such host", Name: "host1"}))
+	assert.False(t, policy.canRetry(request, context.DeadlineExceeded))
+}
+
+func TestRetryPolicy_StatusCodes_ConfigurableFailures(t *testing.T) {
+	policy := constructRetryPolicy(api.RetryPolicyConfig{})
+	for _, statusCode := range []int{500, 502, 503, 504} {
+		assert.True(t, policy.isFailure(&http.Response{StatusCode: statusCode}, nil), statusCode)
+	}
+	assert.False(t, policy.isFailure(&http.Response{StatusCode: http.StatusNotFound}, nil))
+	assert.True(t, policy.isFailure(nil, errors.New("timeout")))
+
+	policy = constructRetryPolicy(api.RetryPolicyConfig{RetryableStatusCodes: []int{429}})
+	assert.True(t, policy.isFailure(&http.Response{StatusCode: http.StatusTooManyRequests}, nil))
+	assert.False(t, policy.isFailure(&http.Response{StatusCode: http.StatusInternalServerError}, nil))
+}
+
+func TestForwardRequest_PostWithoutIdempotencyKey_NotRetried(t *testing.T) {
+	roundTripper := new(MockRoundTripper)
+	roundTripper.On("RoundTrip", mock.Anything).
+		Return(&http.Response{StatusCode: http.StatusServiceUnavailable}, nil)
+	client := &http.Client{
+		Transport: roundTripper,
+	}
+
+	hostManager := Helper_ConstructHostManager()
+	hostManager.RegisterHost("http://host1")
+	hostManager.RegisterHost("http://host2")
+	router := ConstructRoundRobinRouter(client, hostManager, api.RequestHandlingConfig{MaxRetries: 2})
+
+	body := io.NopCloser(bytes.NewReader([]byte(`{"key" : "value"}`)))
+	request, _ := http.NewRequest("POST", "/test", body)
+	resp, err := router.ForwardRequest(request)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	roundTripper.AssertNumberOfCalls(t, "RoundTrip", 1)
+}
+
+func TestForwardRequest_PostConnectionRefused_RetriedOnOtherHost(t *testing.T) {
+	roundTripper := new(MockRoundTripper)
+	mock1 := roundTripper.On("RoundTrip", mock.Anything).
+		Return((*http.Response)(nil), &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}).
+		Once()
+	roundTripper.On("RoundTrip", mock.Anything).
+		Return(&http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil).
+		NotBefore(mock1)
+	client := &http.Client{
+		Transport: roundTripper,
+	}
+
+	hostManager := Helper_ConstructHostManager()
+	hostManager.RegisterHost("http://host1")
+	hostManager.RegisterHost("http://host2")
+	router := ConstructRoundRobinRouter(client, hostManager, api.RequestHandlingConfig{MaxRetries: 2})
+
+	body := io.NopCloser(bytes.NewReader([]byte(`{"key" : "value"}`)))
+	request, _ := http.NewRequest("POST", "/test", body)
+	resp, err := router.ForwardRequest(request)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	roundTripper.AssertNumberOfCalls(t, "RoundTrip", 2)
+}
@@ -1,89 +1,38 @@
 package internal
 
 import (
-	"bytes"
-	"errors"
-	"fmt"
-	"io"
+	"andrewsaputra/routing-app/api"
 	"net/http"
+	"sync/atomic"
 )
 
-func ConstructRoundRobinRouter(client *http.Client, hostManager *HostManager, maxRetries int) *RoundRobinRouter {
+func ConstructRoundRobinRouter(client *http.Client, hostManager *HostManager, requestHandling api.RequestHandlingConfig) *RoundRobinRouter {
 	return &RoundRobinRouter{
-		client:      client,
-		hostManager: hostManager,
-		maxRetries:  maxRetries,
-		hostIndex:   0,
+		forwarder: constructRequestForwarder(client, hostManager, requestHandling),
 	}
 }
 
 type RoundRobinRouter struct {
-	client      *http.Client
-	hostManager *HostManager
-	maxRetries  int
-	hostIndex   int
+	forwarder *requestForwarder
+	counter   atomic.Uint64
 }
 
 func (this *RoundRobinRouter) ForwardRequest(req *http.Request) (*http.Response, error) {
-	var body []byte
-	var err error
-	if req.Body != nil {
-		body, err = io.ReadAll(req.Body)
-		if err != nil {
-			return nil, err
-		}
-	}
-
-	numAttempts := 0
-	for numAttempts <= this.maxRetries {
-		targetHost, err := this.getNextTargetHost()
-		if err != nil {
-			return nil, err
-		}
-
-		url := targetHost + req.URL.Path
-		var newReq *http.Request
-		if req.Body == nil {
-			newReq, err = http.NewRequest(req.Method, url, nil)
-		} else {
-			newReq, err = http.NewRequest(req.Method, url, io.NopCloser(bytes.NewReader(body)))
-		}
-		if err != nil {
-			numAttempts++
-			continue
-		}
-
-		newReq.Header = req.Header
-
-		fmt.Println("forwarding request to :", newReq.URL)
-		resp, err := this.client.Do(newReq)
-		if err != nil || resp.StatusCode == http.StatusInternalServerError {
-			numAttempts++
-			continue
-		}
-
-		return resp, nil
-	}
-
-	return nil, errors.New("request forwarding failed. please try again after a while.")
+	return this.forwarder.forward(req, this.selectHost, nil)
 }
 
 func (this *RoundRobinRouter) getNextTargetHost() (string, error) {
-	hosts := this.hostManager.GetEligibleHosts()
-	lenHosts := len(hosts)
-
-	switch lenHosts {
-	case 0:
-		return "", errors.New("no available hosts")
-	case 1:
-		return hosts[0].Address, nil
-	default:
-		if this.hostIndex >= lenHosts {
-			this.hostIndex = 0
-		}
+	return this.forwarder.nextTargetHost(this.selectHost, nil)
+}
 
-		host := hosts[this.hostIndex]
-		this.hostIndex++
-		return host.Address, nil
+// selectHost claims the next position of the rotation with a single atomic increment, so concurrent
+// requests never observe the same position and hosts stay evenly loaded without locking.
+func (this *RoundRobinRouter) selectHost(hosts []api.Host, tried map[string]bool) string {
+	hosts = untriedHosts(hosts, tried)
+	if len(hosts) == 1 {
+		return hosts[0].Address
 	}
+
+	position := this.counter.Add(1) - 1
+	return hosts[position%uint64(len(hosts))].Address
 }
@@ -1,9 +1,11 @@
 package internal
 
 import (
+	"andrewsaputra/routing-app/api"
 	"bytes"
 	"io"
 	"net/http"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -66,7 +68,7 @@ func TestForwardRequest_NoAvailableHost_ReturnStatusOK(t *testing.T) {
 	assert.Error(t, err)
 }
 
-func TestForwardRequest_HostReturnError_ReturnStatusError(t *testing.T) {
+func TestForwardRequest_HostReturnError_ReturnUpstreamResponse(t *testing.T) {
 	roundTripper := new(MockRoundTripper)
 	roundTripper.On("RoundTrip", mock.Anything).
 		Return(&http.Response{StatusCode: http.StatusInternalServerError}, nil)
@@ -78,14 +80,15 @@ func TestForwardRequest_HostReturnError_ReturnStatusError(t *testing.T) {
 	hostManager := Helper_ConstructHostManager()
 	hostManager.RegisterHost("host1")
 
-	router := ConstructRoundRobinRouter(client, hostManager, 0)
+	router := ConstructRoundRobinRouter(client, hostManager, api.RequestHandlingConfig{MaxRetries: 0})
 
 	body := io.NopCloser(bytes.NewReader([]byte(`{"key" : "value"}`)))
 	request, _ := http.NewRequest("POST", "/test", body)
 	resp, err := router.ForwardRequest(request)
 
-	assert.Nil(t, resp)
-	assert.Error(t, err)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	assert.Equal(t, "host1", resp.Header.Get(routingAttemptsHeader))
 	roundTripper.AssertNumberOfCalls(t, "RoundTrip", 1)
 }
 
@@ -108,10 +111,11 @@ func TestForwardRequest_WithRetryAttempt_ReturnStatusOkAfterRetry(t *testing.T)
 	hostManager.RegisterHost("host2")
 	hostManager.RegisterHost("host3")
 
-	router := ConstructRoundRobinRouter(client, hostManager, 2)
+	router := ConstructRoundRobinRouter(client, hostManager, api.RequestHandlingConfig{MaxRetries: 2})
 
 	body := io.NopCloser(bytes.NewReader([]byte(`{"key" : "value"}`)))
 	request, _ := http.NewRequest("POST", "/test", body)
+	request.Header.Set("Idempotency-Key", "a1b2c3")
 	resp, err := router.ForwardRequest(request)
 
 	assert.Equal(t, http.StatusOK, resp.StatusCode)
@@ -119,6 +123,88 @@ func TestForwardRequest_WithRetryAttempt_ReturnStatusOkAfterRetry(t *testing.T)
 	roundTripper.AssertNumberOfCalls(t, "RoundTrip", 3)
 }
 
+func TestForwardRequest_QueryAndHeaders_ForwardedFaithfully(t *testing.T) {
+	roundTripper := new(MockRoundTripper)
+	roundTripper.On("RoundTrip", mock.Anything).
+		Return(&http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil)
+	client := &http.Client{
+		Transport: roundTripper,
+	}
+
+	hostManager := Helper_ConstructHostManager()
+	hostManager.RegisterHost("http://host1")
+	router := ConstructRoundRobinRouter(client, hostManager, api.RequestHandlingConfig{MaxRetries: 0})
+
+	request, _ := http.NewRequest("GET", "/test?gamer=GYUTDTE&points=20", nil)
+	request.Header.Add("Accept", "application/json")
+	request.Header.Add("Accept", "text/plain")
+	request.Header.Set("Connection", "Upgrade")
+	request.Header.Set("Upgrade", "websocket")
+	_, err := router.ForwardRequest(request)
+	assert.NoError(t, err)
+
+	upstreamReq := roundTripper.Calls[0].Arguments.Get(0).(*http.Request)
+	assert.Equal(t, "http://host1/test?gamer=GYUTDTE&points=20", upstreamReq.URL.String())
+	assert.Equal(t, []string{"application/json", "text/plain"}, upstreamReq.Header.Values("Accept"))
+	assert.Empty(t, upstreamReq.Header.Get("Connection"))
+	assert.Empty(t, upstreamReq.Header.Get("Upgrade"))
+	assert.Equal(t, "websocket", request.Header.Get("Upgrade"))
+}
+
+func TestForwardRequest_ConcurrentRequests_EvenlyDistributed(t *testing.T) {
+	roundTripper := &CountingRoundTripper{counts: map[string]int{}}
+	client := &http.Client{
+		Transport: roundTripper,
+	}
+
+	hostManager := Helper_ConstructHostManager()
+	hostAddresses := []string{"http://host1", "http://host2", "http://host3", "http://host4"}
+	for _, addr := range hostAddresses {
+		hostManager.RegisterHost(addr)
+	}
+	router := ConstructRoundRobinRouter(client, hostManager, api.RequestHandlingConfig{MaxRetries: 0})
+
+	numRequestsPerHost := 1000
+	var wg sync.WaitGroup
+	for i := 0; i < numRequestsPerHost*len(hostAddresses); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			body := io.NopCloser(bytes.NewReader([]byte(`{"key" : "value"}`)))
+			request, _ := http.NewRequest("POST", "/test", body)
+			resp, err := router.ForwardRequest(request)
+			if assert.NoError(t, err) {
+				resp.Body.Close()
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, addr := range hostAddresses {
+		assert.Equal(t, numRequestsPerHost, roundTripper.get(addr))
+	}
+}
+
+type CountingRoundTripper struct {
+	counts map[string]int
+	lock   sync.Mutex
+}
+
+func (this *CountingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	this.counts[req.URL.Scheme+"://"+req.URL.Host]++
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+}
+
+func (this *CountingRoundTripper) get(host string) int {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	return this.counts[host]
+}
+
 /*
 
 func (this *RoundRobinRouter) ForwardRequest(req *http.Request) (*http.Response, error) {
@@ -0,0 +1,67 @@
+package internal
+
+import (
+	"andrewsaputra/routing-app/api"
+	"net/http"
+	"sync"
+)
+
+func ConstructWeightedRoundRobinRouter(client *http.Client, hostManager *HostManager, requestHandling api.RequestHandlingConfig) *WeightedRoundRobinRouter {
+	return &WeightedRoundRobinRouter{
+		forwarder:      constructRequestForwarder(client, hostManager, requestHandling),
+		currentWeights: map[string]int{},
+	}
+}
+
+type WeightedRoundRobinRouter struct {
+	forwarder      *requestForwarder
+	currentWeights map[string]int
+	lock           sync.Mutex
+}
+
+func (this *WeightedRoundRobinRouter) ForwardRequest(req *http.Request) (*http.Response, error) {
+	return this.forwarder.forward(req, this.selectHost, nil)
+}
+
+// selectHost uses the smooth weighted round robin selection from nginx : every candidate host gains its
+// weight on each pick, the host with the highest current weight is selected and then loses the total
+// weight. Heavier hosts get picked more often while still being interleaved with the others. Hosts
+// already tried for the request are skipped and keep their current weight.
+func (this *WeightedRoundRobinRouter) selectHost(hosts []api.Host, tried map[string]bool) string {
+	candidates := untriedHosts(hosts, tried)
+	isCandidate := make(map[string]bool, len(candidates))
+	for _, host := range candidates {
+		isCandidate[host.Address] = true
+	}
+
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	// rebuilt on each pick so that deregistered or unhealthy hosts don't keep stale weights around
+	currentWeights := make(map[string]int, len(hosts))
+	totalWeight := 0
+	selected := ""
+	for _, host := range hosts {
+		if !isCandidate[host.Address] {
+			currentWeights[host.Address] = this.currentWeights[host.Address]
+			continue
+		}
+
+		weight := host.Weight
+		if weight < 1 {
+			weight = defaultHostWeight
+		}
+
+		current := this.currentWeights[host.Address] + weight
+		currentWeights[host.Address] = current
+		totalWeight += weight
+
+		if selected == "" || current > currentWeights[selected] {
+			selected = host.Address
+		}
+	}
+
+	currentWeights[selected] -= totalWeight
+	this.currentWeights = currentWeights
+	return selected
+}
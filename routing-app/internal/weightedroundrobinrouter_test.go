@@ -0,0 +1,73 @@
+package internal
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNextTargetHost_WeightedHosts_ReturnSmoothlyInterleaved(t *testing.T) {
+	router, hostManager := Helper_ConstructWeightedRoundRobinRouter()
+	hostManager.RegisterWeightedHost("host1", 5)
+	hostManager.RegisterWeightedHost("host2", 1)
+	hostManager.RegisterWeightedHost("host3", 1)
+
+	expected := []string{"host1", "host1", "host2", "host1", "host3", "host1", "host1"}
+	for round := 0; round < 3; round++ {
+		for _, host := range expected {
+			target, err := router.forwarder.nextTargetHost(router.selectHost, nil)
+			assert.NoError(t, err)
+			assert.Equal(t, host, target)
+		}
+	}
+}
+
+func TestNextTargetHost_EqualWeights_ReturnWithRoundRobinAlgorithm(t *testing.T) {
+	router, hostManager := Helper_ConstructWeightedRoundRobinRouter()
+	hostAddresses := []string{"host1", "host2", "host3"}
+	for _, addr := range hostAddresses {
+		hostManager.RegisterHost(addr)
+	}
+
+	n := len(hostAddresses)
+	for i := 0; i < 3*n; i++ {
+		target, _ := router.forwarder.nextTargetHost(router.selectHost, nil)
+		assert.Equal(t, hostAddresses[i%n], target)
+	}
+}
+
+func TestNextTargetHost_WeightedHostDeregistered_ReturnRemainingHosts(t *testing.T) {
+	router, hostManager := Helper_ConstructWeightedRoundRobinRouter()
+	hostManager.RegisterWeightedHost("host1", 3)
+	hostManager.RegisterWeightedHost("host2", 1)
+
+	router.forwarder.nextTargetHost(router.selectHost, nil)
+	hostManager.DeregisterHost("host1")
+
+	for i := 0; i < 5; i++ {
+		target, _ := router.forwarder.nextTargetHost(router.selectHost, nil)
+		assert.Equal(t, "host2", target)
+	}
+	assert.Len(t, router.currentWeights, 1)
+}
+
+func TestNextTargetHost_WeightedNoEligibleHost_ReturnError(t *testing.T) {
+	router, _ := Helper_ConstructWeightedRoundRobinRouter()
+	_, err := router.forwarder.nextTargetHost(router.selectHost, nil)
+	assert.Error(t, err)
+}
+
+func TestForwardRequest_WeightedStandard_ReturnStatusOK(t *testing.T) {
+	router, hostManager := Helper_ConstructWeightedRoundRobinRouter()
+	hostManager.RegisterWeightedHost("host1", 2)
+
+	body := io.NopCloser(bytes.NewReader([]byte(`{"key" : "value"}`)))
+	request, _ := http.NewRequest("POST", "/test", body)
+	resp, err := router.ForwardRequest(request)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NoError(t, err)
+}
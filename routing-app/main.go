@@ -45,23 +45,77 @@ func readAppConfig(path string) (*api.AppConfig, error) {
 }
 
 func setupHandler(config *api.AppConfig) (*internal.ApiHandler, error) {
-	hostManager := internal.ConstructHostManager(
+	if _, err := internal.ParseTrustedProxies(config.RequestHandling.TrustedProxies); err != nil {
+		return nil, err
+	}
+
+	if err := internal.ValidateHealthCheckConfig(config.HealthCheck); err != nil {
+		return nil, err
+	}
+
+	if err := internal.ValidateHostLeaseConfig(config.HostLease); err != nil {
+		return nil, err
+	}
+
+	hostStore, err := internal.ConstructHostStore(config.HostStore)
+	if err != nil {
+		return nil, err
+	}
+
+	hostManager, err := internal.ConstructHostManager(
 		&http.Client{
 			Timeout: time.Duration(config.HealthCheck.TimeoutSeconds) * time.Second,
 		},
 		config.HealthCheck,
+		config.HostLease,
+		hostStore,
 	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := hostManager.SyncHosts(internal.HostOriginConfig, config.Hosts); err != nil {
+		return nil, err
+	}
+
+	if config.HostsFile.Path != "" {
+		hostsFileWatcher := internal.ConstructHostsFileWatcher(hostManager, config.HostsFile)
+		if err := hostsFileWatcher.Sync(); err != nil {
+			return nil, err
+		}
+		go hostsFileWatcher.Watch()
+	}
+
+	if config.DnsDiscovery.Name != "" {
+		dnsDiscovery, err := internal.ConstructDnsDiscovery(hostManager, config.DnsDiscovery)
+		if err != nil {
+			return nil, err
+		}
+		go dnsDiscovery.Watch()
+	}
+
+	routingClient := &http.Client{
+		Timeout: time.Duration(config.RequestHandling.TimeoutSeconds) * time.Second,
+	}
 
 	var requestRouter api.RequestRouter
 	switch config.RoutingAlgorithm {
 	case "RoundRobin":
-		requestRouter = internal.ConstructRoundRobinRouter(
-			&http.Client{
-				Timeout: time.Duration(config.RequestHandling.TimeoutSeconds) * time.Second,
-			},
-			hostManager,
-			config.RequestHandling.MaxRetries,
-		)
+		requestRouter = internal.ConstructRoundRobinRouter(routingClient, hostManager, config.RequestHandling)
+	case "WeightedRoundRobin":
+		requestRouter = internal.ConstructWeightedRoundRobinRouter(routingClient, hostManager, config.RequestHandling)
+	case "LeastConnections":
+		requestRouter = internal.ConstructLeastConnectionsRouter(routingClient, hostManager, config.RequestHandling)
+	case "P2C":
+		requestRouter = internal.ConstructPowerOfTwoChoicesRouter(routingClient, hostManager, config.RequestHandling)
+	case "ConsistentHash":
+		router, err := internal.ConstructConsistentHashRouter(routingClient, hostManager, config.RequestHandling, config.ConsistentHash)
+		if err != nil {
+			return nil, err
+		}
+		requestRouter = router
+	case "LatencyAware":
+		requestRouter = internal.ConstructLatencyAwareRouter(routingClient, hostManager, config.RequestHandling, config.LatencyAware)
 	default:
 		msg := fmt.Sprintln("unsupported routing algorithm", config.RoutingAlgorithm)
 		return nil, errors.New(msg)
@@ -72,18 +126,28 @@ func setupHandler(config *api.AppConfig) (*internal.ApiHandler, error) {
 
 func setupRouter(handler api.Handler) *gin.Engine {
 	router := gin.Default()
-	router.GET("/status", statusCheck)
+	router.GET("/status", statusCheck(handler))
 	router.POST("/registerhost", handler.RegisterHost)
 	router.POST("/deregisterhost", handler.DeregisterHost)
+	router.POST("/heartbeat", handler.Heartbeat)
+	router.GET("/hosts", handler.ListHosts)
+	router.PUT("/hosts", handler.ReplaceHosts)
+	router.POST("/hosts/batch", handler.ApplyHostBatch)
+	router.GET("/hosts/*ref", handler.GetHost)
+	router.PATCH("/hosts/*ref", handler.UpdateHost)
+	router.DELETE("/hosts/*ref", handler.RemoveHost)
 	router.NoRoute(handler.ForwardRequest)
 
 	return router
 }
 
-func statusCheck(c *gin.Context) {
-	response := map[string]any{}
-	response["status"] = "Healthy"
-	response["startedAt"] = startTime.Format(time.RFC1123Z)
+func statusCheck(handler api.Handler) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		response := map[string]any{}
+		response["status"] = "Healthy"
+		response["startedAt"] = startTime.Format(time.RFC1123Z)
+		response["hosts"] = handler.HealthSummary()
 
-	c.JSON(http.StatusOK, response)
+		c.JSON(http.StatusOK, response)
+	}
 }
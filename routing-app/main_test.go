@@ -40,6 +40,168 @@ func TestSetupAppHandler_WithRoundRobinAlgoritm_ReturnHandler(t *testing.T) {
 	assert.IsType(t, &internal.RoundRobinRouter{}, handler.RequestRouter)
 }
 
+func TestSetupAppHandler_WithWeightedRoundRobinAlgoritm_ReturnHandler(t *testing.T) {
+	config := &api.AppConfig{
+		RoutingAlgorithm: "WeightedRoundRobin",
+		RequestHandling:  api.RequestHandlingConfig{MaxRetries: 0, TimeoutSeconds: 5},
+		HealthCheck:      api.HealthCheckConfig{Path: "/status", NumRequired: 1, IntervalSeconds: 1, TimeoutSeconds: 1},
+	}
+	handler, err := setupHandler(config)
+
+	assert.Nil(t, err)
+	assert.IsType(t, &internal.WeightedRoundRobinRouter{}, handler.RequestRouter)
+}
+
+func TestSetupAppHandler_WithLeastConnectionsAlgoritm_ReturnHandler(t *testing.T) {
+	config := &api.AppConfig{
+		RoutingAlgorithm: "LeastConnections",
+		RequestHandling:  api.RequestHandlingConfig{MaxRetries: 0, TimeoutSeconds: 5},
+		HealthCheck:      api.HealthCheckConfig{Path: "/status", NumRequired: 1, IntervalSeconds: 1, TimeoutSeconds: 1},
+	}
+	handler, err := setupHandler(config)
+
+	assert.Nil(t, err)
+	assert.IsType(t, &internal.LeastConnectionsRouter{}, handler.RequestRouter)
+}
+
+func TestSetupAppHandler_WithP2CAlgoritm_ReturnHandler(t *testing.T) {
+	config := &api.AppConfig{
+		RoutingAlgorithm: "P2C",
+		RequestHandling:  api.RequestHandlingConfig{MaxRetries: 0, TimeoutSeconds: 5},
+		HealthCheck:      api.HealthCheckConfig{Path: "/status", NumRequired: 1, IntervalSeconds: 1, TimeoutSeconds: 1},
+	}
+	handler, err := setupHandler(config)
+
+	assert.Nil(t, err)
+	assert.IsType(t, &internal.PowerOfTwoChoicesRouter{}, handler.RequestRouter)
+}
+
+func TestSetupAppHandler_WithConsistentHashAlgoritm_ReturnHandler(t *testing.T) {
+	config := &api.AppConfig{
+		RoutingAlgorithm: "ConsistentHash",
+		RequestHandling:  api.RequestHandlingConfig{MaxRetries: 0, TimeoutSeconds: 5},
+		HealthCheck:      api.HealthCheckConfig{Path: "/status", NumRequired: 1, IntervalSeconds: 1, TimeoutSeconds: 1},
+		ConsistentHash:   api.ConsistentHashConfig{KeySource: "JsonField", KeyName: "gamerID"},
+	}
+	handler, err := setupHandler(config)
+
+	assert.Nil(t, err)
+	assert.IsType(t, &internal.ConsistentHashRouter{}, handler.RequestRouter)
+}
+
+func TestSetupAppHandler_WithInvalidConsistentHashConfig_ReturnError(t *testing.T) {
+	config := &api.AppConfig{
+		RoutingAlgorithm: "ConsistentHash",
+		RequestHandling:  api.RequestHandlingConfig{MaxRetries: 0, TimeoutSeconds: 5},
+		HealthCheck:      api.HealthCheckConfig{Path: "/status", NumRequired: 1, IntervalSeconds: 1, TimeoutSeconds: 1},
+	}
+	handler, err := setupHandler(config)
+
+	assert.NotNil(t, err)
+	assert.Nil(t, handler)
+}
+
+func TestSetupAppHandler_WithLatencyAwareAlgoritm_ReturnHandler(t *testing.T) {
+	config := &api.AppConfig{
+		RoutingAlgorithm: "LatencyAware",
+		RequestHandling:  api.RequestHandlingConfig{MaxRetries: 0, TimeoutSeconds: 5},
+		HealthCheck:      api.HealthCheckConfig{Path: "/status", NumRequired: 1, IntervalSeconds: 1, TimeoutSeconds: 1},
+	}
+	handler, err := setupHandler(config)
+
+	assert.Nil(t, err)
+	assert.IsType(t, &internal.LatencyAwareRouter{}, handler.RequestRouter)
+}
+
+func TestSetupAppHandler_WithInvalidTrustedProxies_ReturnError(t *testing.T) {
+	config := &api.AppConfig{
+		RoutingAlgorithm: "RoundRobin",
+		RequestHandling:  api.RequestHandlingConfig{MaxRetries: 0, TimeoutSeconds: 5, TrustedProxies: []string{"not-an-ip"}},
+		HealthCheck:      api.HealthCheckConfig{Path: "/status", NumRequired: 1, IntervalSeconds: 1, TimeoutSeconds: 1},
+	}
+	handler, err := setupHandler(config)
+
+	assert.NotNil(t, err)
+	assert.Nil(t, handler)
+}
+
+func TestSetupAppHandler_WithUnknownNoHealthyHostPolicy_ReturnError(t *testing.T) {
+	config := &api.AppConfig{
+		RoutingAlgorithm: "RoundRobin",
+		RequestHandling:  api.RequestHandlingConfig{MaxRetries: 0, TimeoutSeconds: 5},
+		HealthCheck:      api.HealthCheckConfig{Path: "/status", NumRequired: 1, IntervalSeconds: 1, TimeoutSeconds: 1, NoHealthyHostPolicy: "unknown"},
+	}
+	handler, err := setupHandler(config)
+
+	assert.NotNil(t, err)
+	assert.Nil(t, handler)
+}
+
+func TestSetupAppHandler_WithUnknownHostStore_ReturnError(t *testing.T) {
+	config := &api.AppConfig{
+		RoutingAlgorithm: "RoundRobin",
+		RequestHandling:  api.RequestHandlingConfig{MaxRetries: 0, TimeoutSeconds: 5},
+		HealthCheck:      api.HealthCheckConfig{Path: "/status", NumRequired: 1, IntervalSeconds: 1, TimeoutSeconds: 1},
+		HostStore:        api.HostStoreConfig{Type: "unknown", Path: "hosts.db"},
+	}
+	handler, err := setupHandler(config)
+
+	assert.NotNil(t, err)
+	assert.Nil(t, handler)
+}
+
+func TestSetupAppHandler_WithInvalidStaticHosts_ReturnError(t *testing.T) {
+	config := &api.AppConfig{
+		RoutingAlgorithm: "RoundRobin",
+		RequestHandling:  api.RequestHandlingConfig{MaxRetries: 0, TimeoutSeconds: 5},
+		HealthCheck:      api.HealthCheckConfig{Path: "/status", NumRequired: 1, IntervalSeconds: 1, TimeoutSeconds: 1},
+		Hosts:            []api.HostSpec{{Address: "http://localhost:4001"}, {Address: "http://localhost:4001"}},
+	}
+	handler, err := setupHandler(config)
+
+	assert.NotNil(t, err)
+	assert.Nil(t, handler)
+}
+
+func TestSetupAppHandler_WithMissingHostsFile_ReturnError(t *testing.T) {
+	config := &api.AppConfig{
+		RoutingAlgorithm: "RoundRobin",
+		RequestHandling:  api.RequestHandlingConfig{MaxRetries: 0, TimeoutSeconds: 5},
+		HealthCheck:      api.HealthCheckConfig{Path: "/status", NumRequired: 1, IntervalSeconds: 1, TimeoutSeconds: 1},
+		HostsFile:        api.HostsFileConfig{Path: "missing/hosts.json"},
+	}
+	handler, err := setupHandler(config)
+
+	assert.NotNil(t, err)
+	assert.Nil(t, handler)
+}
+
+func TestSetupAppHandler_WithInvalidDnsDiscovery_ReturnError(t *testing.T) {
+	config := &api.AppConfig{
+		RoutingAlgorithm: "RoundRobin",
+		RequestHandling:  api.RequestHandlingConfig{MaxRetries: 0, TimeoutSeconds: 5},
+		HealthCheck:      api.HealthCheckConfig{Path: "/status", NumRequired: 1, IntervalSeconds: 1, TimeoutSeconds: 1},
+		DnsDiscovery:     api.DnsDiscoveryConfig{Name: "api.service.local", RecordType: "A"},
+	}
+	handler, err := setupHandler(config)
+
+	assert.NotNil(t, err)
+	assert.Nil(t, handler)
+}
+
+func TestSetupAppHandler_WithInvalidHostLease_ReturnError(t *testing.T) {
+	config := &api.AppConfig{
+		RoutingAlgorithm: "RoundRobin",
+		RequestHandling:  api.RequestHandlingConfig{MaxRetries: 0, TimeoutSeconds: 5},
+		HealthCheck:      api.HealthCheckConfig{Path: "/status", NumRequired: 1, IntervalSeconds: 1, TimeoutSeconds: 1},
+		HostLease:        api.HostLeaseConfig{DefaultTtlSeconds: 600, MaxTtlSeconds: 300},
+	}
+	handler, err := setupHandler(config)
+
+	assert.NotNil(t, err)
+	assert.Nil(t, handler)
+}
+
 func TestSetupAppHandler_WithUnknownAlgoritm_ReturnError(t *testing.T) {
 	config := &api.AppConfig{
 		RoutingAlgorithm: "unknown",
@@ -54,6 +216,7 @@ func TestSetupAppHandler_WithUnknownAlgoritm_ReturnError(t *testing.T) {
 
 func TestSetupRouter_RegisterRoutes_StatusCheckSuccess(t *testing.T) {
 	handler := new(MockHandler)
+	handler.On("HealthSummary").Return(map[string]any{"noHealthyHostPolicy": "FailClosed"})
 	router := setupRouter(handler)
 
 	response := httptest.NewRecorder()
@@ -65,12 +228,20 @@ func TestSetupRouter_RegisterRoutes_StatusCheckSuccess(t *testing.T) {
 
 	assert.Equal(t, 200, response.Code)
 	assert.Equal(t, "Healthy", responseJson["status"])
+	assert.Equal(t, map[string]any{"noHealthyHostPolicy": "FailClosed"}, responseJson["hosts"])
 }
 
 func TestSetupRouter_RegisterRoutes_HandlerFunctionsCalled(t *testing.T) {
 	handler := new(MockHandler)
 	handler.On("RegisterHost", mock.Anything).Return()
 	handler.On("DeregisterHost", mock.Anything).Return()
+	handler.On("Heartbeat", mock.Anything).Return()
+	handler.On("ListHosts", mock.Anything).Return()
+	handler.On("GetHost", mock.Anything).Return()
+	handler.On("ReplaceHosts", mock.Anything).Return()
+	handler.On("UpdateHost", mock.Anything).Return()
+	handler.On("RemoveHost", mock.Anything).Return()
+	handler.On("ApplyHostBatch", mock.Anything).Return()
 	handler.On("ForwardRequest", mock.Anything).Return()
 
 	router := setupRouter(handler)
@@ -84,6 +255,34 @@ func TestSetupRouter_RegisterRoutes_HandlerFunctionsCalled(t *testing.T) {
 	router.ServeHTTP(httptest.NewRecorder(), request)
 	handler.AssertCalled(t, "DeregisterHost", mock.Anything)
 
+	request, _ = http.NewRequest("POST", "/heartbeat", bytes.NewReader(payload))
+	router.ServeHTTP(httptest.NewRecorder(), request)
+	handler.AssertCalled(t, "Heartbeat", mock.Anything)
+
+	request, _ = http.NewRequest("GET", "/hosts", nil)
+	router.ServeHTTP(httptest.NewRecorder(), request)
+	handler.AssertCalled(t, "ListHosts", mock.Anything)
+
+	request, _ = http.NewRequest("GET", "/hosts/http://localhost:4001", nil)
+	router.ServeHTTP(httptest.NewRecorder(), request)
+	handler.AssertCalled(t, "GetHost", mock.Anything)
+
+	request, _ = http.NewRequest("PUT", "/hosts", bytes.NewReader(payload))
+	router.ServeHTTP(httptest.NewRecorder(), request)
+	handler.AssertCalled(t, "ReplaceHosts", mock.Anything)
+
+	request, _ = http.NewRequest("PATCH", "/hosts/host-1", bytes.NewReader(payload))
+	router.ServeHTTP(httptest.NewRecorder(), request)
+	handler.AssertCalled(t, "UpdateHost", mock.Anything)
+
+	request, _ = http.NewRequest("DELETE", "/hosts/host-1", nil)
+	router.ServeHTTP(httptest.NewRecorder(), request)
+	handler.AssertCalled(t, "RemoveHost", mock.Anything)
+
+	request, _ = http.NewRequest("POST", "/hosts/batch", bytes.NewReader(payload))
+	router.ServeHTTP(httptest.NewRecorder(), request)
+	handler.AssertCalled(t, "ApplyHostBatch", mock.Anything)
+
 	request, _ = http.NewRequest("POST", "/other", bytes.NewReader(payload))
 	router.ServeHTTP(httptest.NewRecorder(), request)
 	handler.AssertCalled(t, "ForwardRequest", mock.Anything)
@@ -101,6 +300,40 @@ func (this *MockHandler) DeregisterHost(c *gin.Context) {
 	this.Called(c)
 }
 
+func (this *MockHandler) Heartbeat(c *gin.Context) {
+	this.Called(c)
+}
+
+func (this *MockHandler) ListHosts(c *gin.Context) {
+	this.Called(c)
+}
+
+func (this *MockHandler) GetHost(c *gin.Context) {
+	this.Called(c)
+}
+
+func (this *MockHandler) ReplaceHosts(c *gin.Context) {
+	this.Called(c)
+}
+
+func (this *MockHandler) UpdateHost(c *gin.Context) {
+	this.Called(c)
+}
+
+func (this *MockHandler) RemoveHost(c *gin.Context) {
+	this.Called(c)
+}
+
+func (this *MockHandler) ApplyHostBatch(c *gin.Context) {
+	this.Called(c)
+}
+
 func (this *MockHandler) ForwardRequest(c *gin.Context) {
 	this.Called(c)
 }
+
+func (this *MockHandler) HealthSummary() map[string]any {
+	args := this.Called()
+	summary, _ := args.Get(0).(map[string]any)
+	return summary
+}